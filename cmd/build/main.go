@@ -3,10 +3,18 @@ package main
 import (
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 
 	"github.com/buildpacks/libbuildpack/v2/build"
 
 	"github.com/jromero/openfaas-cnb/cmd"
+	"github.com/jromero/openfaas-cnb/pkg/functionprocess"
+	"github.com/jromero/openfaas-cnb/pkg/healthcheck"
+	"github.com/jromero/openfaas-cnb/pkg/launch"
+	"github.com/jromero/openfaas-cnb/pkg/secrets"
+	"github.com/jromero/openfaas-cnb/pkg/shim"
+	"github.com/jromero/openfaas-cnb/pkg/template"
 	"github.com/jromero/openfaas-cnb/pkg/watchdog"
 )
 
@@ -16,24 +24,146 @@ func main() {
 		cmd.Exit(cmd.UnexpectedError, err)
 	}
 
-	conf := watchdog.DefaultConfig()
-	configPath := watchdog.ConfigPath(b.Application.Root)
-	if fh, err := os.Open(configPath); err != nil {
-		if !os.IsNotExist(err) {
-			cmd.ExitWithLogger(b.Logger, cmd.UnexpectedError, err)
-		}
-	} else {
-		defer fh.Close()
-		conf, err = watchdog.ParseConfig(fh)
+	configSources, err := watchdog.ConfigPaths(b.Application.Root, b.Platform.EnvironmentVariables[watchdog.ConfigEnv])
+	if err != nil {
+		cmd.ExitWithLogger(b.Logger, cmd.UnexpectedError, err)
+	}
+
+	profile := b.Platform.EnvironmentVariables[watchdog.ProfileEnv]
+	conf, err := watchdog.LoadConfig(configSources, profile, b.Platform.EnvironmentVariables)
+	if err != nil {
+		cmd.ExitWithLogger(b.Logger, cmd.ParseConfigError, err)
+	}
+
+	conf, planEntry, err := watchdog.ResolvePlan(conf, b.Plans.Entries)
+	if err != nil {
+		cmd.ExitWithLogger(b.Logger, cmd.ResolvePlanError, err)
+	}
+
+	api, err := launch.ReadAPI(b.Buildpack.Root)
+	if err != nil {
+		cmd.ExitWithLogger(b.Logger, cmd.UnexpectedError, err)
+	}
+	launchMetadata := launch.NewMetadata(api)
+
+	conf, err = watchdog.ResolveStaticPath(conf, b.Application.Root)
+	if err != nil {
+		cmd.ExitWithLogger(b.Logger, cmd.ParseConfigError, err)
+	}
+
+	var tmpl template.Template
+	if conf.Template != "" {
+		tmpl, err = template.Lookup(conf.Template)
 		if err != nil {
 			cmd.ExitWithLogger(b.Logger, cmd.ParseConfigError, err)
 		}
+		conf = watchdog.ApplyTemplate(conf, tmpl)
 	}
 
-	contributor := watchdog.NewContributor(b.Logger, http.DefaultClient)
-	_, err = contributor.Contribute(b.Layers, conf)
+	// static mode serves files, so there is no handler to generate an entrypoint for
+	if conf.Template != "" && conf.Mode != watchdog.StaticMode {
+		s, generate, err := shim.Generate(b.Application.Root, tmpl)
+		if err != nil {
+			cmd.ExitWithLogger(b.Logger, cmd.UnexpectedError, err)
+		}
+
+		if generate {
+			conf, err = watchdog.ApplyShim(conf, s)
+			if err != nil {
+				cmd.ExitWithLogger(b.Logger, cmd.ParseConfigError, err)
+			}
+
+			b.Logger.Info("Generating '%s' entrypoint shim", tmpl.Name)
+			shimLayer, err := shim.Contribute(b.Logger, b.Layers, api, b.Application.Root, s)
+			if err != nil {
+				b.Logger.Info(err.Error())
+				os.Exit(b.Failure(cmd.LayerCreationError))
+			}
+
+			warning, err := shim.OrderWarning(filepath.Dir(b.Layers.Root), b.Buildpack.Info.ID, s)
+			if err != nil {
+				b.Logger.Debug("unable to check the buildpack order: %s", err)
+			} else if warning != "" {
+				b.Logger.Info("Warning: %s", warning)
+			}
+
+			if s.Launched() {
+				if err := launchMetadata.AddProcess("shim", s.Process(shimLayer)); err != nil {
+					cmd.ExitWithLogger(b.Logger, cmd.UnexpectedError, err)
+				}
+			}
+		}
+	}
+
+	processTypes, err := watchdog.ProcessTypes(b.Application.Root)
+	if err != nil {
+		cmd.ExitWithLogger(b.Logger, cmd.ParseConfigError, err)
+	}
+
+	// without process types defined by the application, those available at launch are unknown
+	if len(processTypes) > 0 {
+		processTypes = append(processTypes, launchMetadata.ProcessTypes()...)
+	}
+
+	conf, err = watchdog.ResolveProcessType(conf, processTypes)
 	if err != nil {
+		cmd.ExitWithLogger(b.Logger, cmd.ProcessTypeError, err)
+	}
+
+	conf, err = watchdog.ResolveDefaultProcess(conf, b.Application.Root)
+	if err != nil {
+		cmd.ExitWithLogger(b.Logger, cmd.ParseConfigError, err)
+	}
+
+	conf, err = watchdog.ResolveDirect(conf, b.Application.Root)
+	if err != nil {
+		cmd.ExitWithLogger(b.Logger, cmd.UnexpectedError, err)
+	}
+
+	if conf.Profile != "" {
+		b.Logger.Info("Using watchdog profile '%s'", conf.Profile)
+	}
+
+	if explain, _ := strconv.ParseBool(b.Platform.EnvironmentVariables[watchdog.ExplainEnv]); explain {
+		b.Logger.Info("Effective watchdog configuration:\n%s", watchdog.Explain(conf))
+	}
+
+	watchdogLayer, err := watchdog.NewContributor(b.Logger, http.DefaultClient).Contribute(b.Layers, launchMetadata, conf)
+	if err != nil {
+		b.Logger.Info(err.Error())
+		os.Exit(b.Failure(cmd.LayerCreationError))
+	}
+
+	healthcheckPath := filepath.Join(b.Buildpack.Root, "bin", healthcheck.HelperName)
+	if err := healthcheck.Contribute(*watchdogLayer, launchMetadata, healthcheckPath); err != nil {
 		b.Logger.Info(err.Error())
 		os.Exit(b.Failure(cmd.LayerCreationError))
 	}
+
+	helperPath := filepath.Join(b.Buildpack.Root, "bin", functionprocess.HelperName)
+	if err := functionprocess.Contribute(b.Logger, b.Layers, api, helperPath); err != nil {
+		b.Logger.Info(err.Error())
+		os.Exit(b.Failure(cmd.LayerCreationError))
+	}
+
+	secretsHelperPath := filepath.Join(b.Buildpack.Root, "bin", secrets.HelperName)
+	err = secrets.Contribute(b.Logger, b.Layers, api, secretsHelperPath, secrets.FromConfig(conf))
+	if err != nil {
+		b.Logger.Info(err.Error())
+		os.Exit(b.Failure(cmd.LayerCreationError))
+	}
+
+	if err := launchMetadata.Write(b.Layers); err != nil {
+		b.Logger.Info(err.Error())
+		os.Exit(b.Failure(cmd.LayerCreationError))
+	}
+
+	// every entry is met, as a version that can't be resolved fails the build, so from ReadOnlyPlanAPI there is no
+	// [[unmet]] entry to declare; the resolved version is recorded in the bill of materials instead
+	if err := launch.WritePlan(b.Writer, api, planEntry); err != nil {
+		cmd.ExitWithLogger(b.Logger, cmd.UnexpectedError, err)
+	}
+
+	b.Logger.Debug("Build success. Exiting with %d.", build.SuccessStatusCode)
+	os.Exit(build.SuccessStatusCode)
 }
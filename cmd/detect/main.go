@@ -1,11 +1,41 @@
 package main
 
 import (
+	"errors"
 	"os"
 
 	"github.com/buildpacks/libbuildpack/v2/detect"
+
+	"github.com/jromero/openfaas-cnb/cmd"
+	"github.com/jromero/openfaas-cnb/pkg/watchdog"
 )
 
 func main() {
-	os.Exit(detect.PassStatusCode)
+	d, err := detect.DefaultDetect()
+	if err != nil {
+		cmd.Exit(cmd.UnexpectedError, err)
+	}
+
+	detection, err := watchdog.Detect(d.Application.Root, d.Platform.EnvironmentVariables)
+	if errors.As(err, &watchdog.ConfigError{}) {
+		cmd.ExitWithLogger(d.Logger, d.Error(cmd.ParseConfigError), err)
+	} else if err != nil {
+		cmd.ExitWithLogger(d.Logger, d.Error(cmd.UnexpectedError), err)
+	}
+
+	if !detection.Passed() {
+		d.Logger.Debug(detection.Reason)
+		os.Exit(d.Fail())
+	}
+
+	if detection.Template != "" {
+		d.Logger.Debug("using template '%s'", detection.Template)
+	}
+
+	code, err := d.Pass(detection.Plans...)
+	if err != nil {
+		cmd.ExitWithLogger(d.Logger, d.Error(cmd.UnexpectedError), err)
+	}
+
+	os.Exit(code)
 }
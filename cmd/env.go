@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+)
+
+// Environ returns the environment variables of the process by name, for the helpers run when the container starts.
+func Environ() map[string]string {
+	env := map[string]string{}
+	for _, variable := range os.Environ() {
+		if parts := strings.SplitN(variable, "=", 2); len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+
+	return env
+}
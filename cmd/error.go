@@ -11,6 +11,8 @@ import (
 const (
 	ParseConfigError   = detect.FailStatusCode + 1
 	LayerCreationError = detect.FailStatusCode + 2
+	ResolvePlanError   = detect.FailStatusCode + 3
+	ProcessTypeError   = detect.FailStatusCode + 4
 	UnexpectedError    = detect.FailStatusCode + 9
 )
 
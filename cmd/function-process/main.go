@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+
+	"github.com/jromero/openfaas-cnb/cmd"
+	"github.com/jromero/openfaas-cnb/pkg/functionprocess"
+	"github.com/jromero/openfaas-cnb/pkg/launch"
+)
+
+// main resolves function_process, and expands the launch-time references of the watchdog's env vars, when the container
+// starts, as an exec.d executable writing them to file descriptor 3.
+func main() {
+	env := cmd.Environ()
+
+	if _, ok := env["CNB_APP_DIR"]; !ok {
+		if wd, err := os.Getwd(); err == nil {
+			env["CNB_APP_DIR"] = wd
+		}
+	}
+
+	out, err := functionprocess.Expand(env)
+	if err != nil {
+		cmd.Exit(cmd.UnexpectedError, err)
+	}
+
+	functionProcess, resolved, err := functionprocess.Resolve(env)
+	if err != nil {
+		cmd.Exit(cmd.UnexpectedError, err)
+	}
+
+	if resolved {
+		out["function_process"] = functionProcess
+	}
+
+	if len(out) == 0 {
+		return
+	}
+
+	if err := launch.WriteExecDEnv(os.NewFile(3, "fd3"), out); err != nil {
+		cmd.Exit(cmd.UnexpectedError, err)
+	}
+}
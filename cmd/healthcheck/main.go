@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jromero/openfaas-cnb/cmd"
+	"github.com/jromero/openfaas-cnb/pkg/healthcheck"
+)
+
+// timeout bounds the health check, so that probes fail rather than hang.
+const timeout = 5 * time.Second
+
+// main exits 0 when the watchdog is healthy and 1 otherwise, for use in Docker HEALTHCHECKs and Kubernetes exec
+// probes. The port may be given as the only argument, e.g. for a 'faas-<name>' process with its own port.
+func main() {
+	if err := healthcheck.Check(cmd.Environ(), os.Args[1:], &http.Client{Timeout: timeout}); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "unhealthy: "+err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jromero/openfaas-cnb/cmd"
+	"github.com/jromero/openfaas-cnb/pkg/watchdog"
+)
+
+func main() {
+	schema, err := watchdog.Schema()
+	if err != nil {
+		cmd.Exit(cmd.UnexpectedError, err)
+	}
+
+	fmt.Println(string(schema))
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jromero/openfaas-cnb/cmd"
+	"github.com/jromero/openfaas-cnb/pkg/launch"
+	"github.com/jromero/openfaas-cnb/pkg/secrets"
+)
+
+// main exports the function's secrets when the container starts, as an exec.d executable writing them to file
+// descriptor 3. Their values are never printed.
+func main() {
+	executable, err := os.Executable()
+	if err != nil {
+		cmd.Exit(cmd.UnexpectedError, err)
+	}
+
+	// the helper is installed into the 'exec.d' directory of its layer
+	layerDir := filepath.Dir(filepath.Dir(executable))
+	declared, err := secrets.ReadConfig(filepath.Join(layerDir, secrets.ConfigName))
+	if err != nil {
+		cmd.Exit(cmd.UnexpectedError, err)
+	}
+
+	env, missing, err := secrets.Resolve(secrets.DefaultDir, declared)
+	if err != nil {
+		cmd.Exit(cmd.UnexpectedError, err)
+	}
+
+	for _, name := range missing {
+		_, _ = fmt.Fprintf(os.Stderr, "optional secret '%s' not found, skipping\n", name)
+	}
+
+	if err := launch.WriteExecDEnv(os.NewFile(3, "fd3"), env); err != nil {
+		cmd.Exit(cmd.UnexpectedError, err)
+	}
+}
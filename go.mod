@@ -6,6 +6,7 @@ require (
 	github.com/gojuno/minimock/v3 v3.0.6
 	github.com/onsi/ginkgo v1.12.0
 	github.com/onsi/gomega v1.9.0
+	gopkg.in/yaml.v2 v2.2.8
 )
 
 go 1.13
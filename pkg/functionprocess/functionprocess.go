@@ -0,0 +1,142 @@
+package functionprocess
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/buildpacks/libbuildpack/v2/layers"
+	"github.com/buildpacks/libbuildpack/v2/logger"
+
+	"github.com/jromero/openfaas-cnb/pkg/launch"
+	"github.com/jromero/openfaas-cnb/pkg/watchdog"
+)
+
+const (
+	// ProcessTypeEnv is the launch environment variable selecting the process type run by the watchdog.
+	ProcessTypeEnv = "OPENFAAS_PROCESS_TYPE"
+	// HelperName is the exec.d helper resolving the process type at launch.
+	HelperName = "function-process"
+
+	layerName        = "function-process"
+	defaultAppDir    = "/workspace"
+	defaultLayersDir = "/layers"
+	watchdogType     = "faas"
+)
+
+// Resolve returns the function_process running the process type selected by ProcessTypeEnv in env, or false when none
+// is selected, so that the value written at build time is used. The selected process type must be one of those
+// defined by the application's Procfile or project.toml, or the image's launch metadata, when they are known.
+func Resolve(env map[string]string) (string, bool, error) {
+	processType := env[ProcessTypeEnv]
+	if processType == "" {
+		return "", false, nil
+	}
+
+	if processType == watchdogType || strings.HasPrefix(processType, watchdogType+"-") {
+		return "", false, fmt.Errorf("%s '%s' runs the watchdog itself", ProcessTypeEnv, processType)
+	}
+
+	types, err := processTypes(env)
+	if err != nil {
+		return "", false, err
+	}
+
+	available := map[string]bool{}
+	for _, availableType := range types {
+		available[availableType] = true
+	}
+
+	if len(types) > 0 && !available[processType] {
+		return "", false, fmt.Errorf(
+			"%s '%s' not found, available process types: [%s]", ProcessTypeEnv, processType, strings.Join(types, ", "),
+		)
+	}
+
+	// with default_process, the application's web process may be replaced by the watchdog and run as web-upstream
+	if processType == watchdog.WebProcessType && available[watchdog.WebUpstreamProcessType] {
+		processType = watchdog.WebUpstreamProcessType
+	}
+
+	return watchdog.FunctionProcess(processType), true, nil
+}
+
+// processTypes returns the sorted process types available at launch, except those running the watchdog.
+func processTypes(env map[string]string) ([]string, error) {
+	appDir := env["CNB_APP_DIR"]
+	if appDir == "" {
+		appDir = defaultAppDir
+	}
+
+	layersDir := env["CNB_LAYERS_DIR"]
+	if layersDir == "" {
+		layersDir = defaultLayersDir
+	}
+
+	types, err := watchdog.ProcessTypes(appDir)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for _, definedType := range types {
+		seen[definedType] = true
+	}
+
+	var md layers.Metadata
+	if _, err := toml.DecodeFile(filepath.Join(layersDir, "config", "metadata.toml"), &md); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading launch metadata: %s", err)
+	}
+	for _, process := range md.Processes {
+		if process.Type != watchdogType && !strings.HasPrefix(process.Type, watchdogType+"-") && !seen[process.Type] {
+			seen[process.Type] = true
+			types = append(types, process.Type)
+		}
+	}
+
+	sort.Strings(types)
+	return types, nil
+}
+
+// Expand returns the watchdog env vars listed by watchdog.ExpandEnv in env with their launch-time references, such as
+// '${PORT}', expanded from env.
+func Expand(env map[string]string) (map[string]string, error) {
+	expanded := map[string]string{}
+	for _, key := range strings.Split(env[watchdog.ExpandEnv], ",") {
+		if key == "" {
+			continue
+		}
+
+		value, err := watchdog.ExpandReferences(env[key], env)
+		if err != nil {
+			return nil, fmt.Errorf("expanding %s: %s", key, err)
+		}
+		expanded[key] = value
+	}
+
+	return expanded, nil
+}
+
+// Contribute copies the helper at helperPath into a launch layer as an exec.d executable, which resolves
+// function_process, and expands the launch-time references of the watchdog's env vars, when the container starts. It
+// requires launch.ExecDAPI, so is skipped for older buildpack APIs.
+func Contribute(log logger.Logger, lyrs layers.Layers, api launch.API, helperPath string) error {
+	helperLayer := lyrs.Layer(layerName)
+	if err := launch.RemoveLayer(helperLayer); err != nil {
+		return errors.New("removing previous helper: " + err.Error())
+	}
+
+	if !api.Supports(launch.ExecDAPI) {
+		log.Info(
+			"Resolving function_process at launch requires buildpack API %s or later, the buildpack declares %s",
+			launch.ExecDAPI, api,
+		)
+		return nil
+	}
+
+	return launch.ContributeExecD(helperLayer, api, HelperName, helperPath)
+}
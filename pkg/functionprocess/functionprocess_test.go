@@ -0,0 +1,172 @@
+package functionprocess_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buildpacks/libbuildpack/v2/layers"
+	"github.com/buildpacks/libbuildpack/v2/logger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/jromero/openfaas-cnb/pkg/functionprocess"
+	"github.com/jromero/openfaas-cnb/pkg/launch"
+)
+
+func TestFunctionProcess(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "FunctionProcess")
+}
+
+var _ = Describe("FunctionProcess", func() {
+	var (
+		tmpDir    string
+		appDir    string
+		layersDir string
+		env       map[string]string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "")
+		Expect(err).To(BeNil())
+
+		appDir = filepath.Join(tmpDir, "workspace")
+		layersDir = filepath.Join(tmpDir, "layers")
+		Expect(os.MkdirAll(appDir, os.ModePerm)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(layersDir, "config"), os.ModePerm)).To(Succeed())
+
+		env = map[string]string{"CNB_APP_DIR": appDir, "CNB_LAYERS_DIR": layersDir}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(BeNil())
+	})
+
+	Describe("Resolve", func() {
+		It("uses the build-time value when no process type is selected", func() {
+			_, resolved, err := functionprocess.Resolve(env)
+			Expect(err).To(BeNil())
+			Expect(resolved).To(BeFalse())
+		})
+
+		It("runs the selected process type", func() {
+			Expect(ioutil.WriteFile(filepath.Join(appDir, "Procfile"), []byte("web: ruby app.rb\n"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(layersDir, "config", "metadata.toml"), []byte(`
+[[processes]]
+type = "worker"
+command = "ruby worker.rb"
+
+[[processes]]
+type = "faas"
+command = "watchdog"
+`), 0644)).To(Succeed())
+			env["OPENFAAS_PROCESS_TYPE"] = "worker"
+
+			functionProcess, resolved, err := functionprocess.Resolve(env)
+			Expect(err).To(BeNil())
+			Expect(resolved).To(BeTrue())
+			Expect(functionProcess).To(Equal("/cnb/lifecycle/launcher worker"))
+		})
+
+		It("fails when the selected process type is unknown", func() {
+			Expect(ioutil.WriteFile(filepath.Join(appDir, "Procfile"), []byte("web: ruby app.rb\n"), 0644)).To(Succeed())
+			env["OPENFAAS_PROCESS_TYPE"] = "worker"
+
+			_, _, err := functionprocess.Resolve(env)
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(Equal("OPENFAAS_PROCESS_TYPE 'worker' not found, available process types: [web]"))
+		})
+
+		It("runs the replaced web process when web is selected", func() {
+			Expect(ioutil.WriteFile(filepath.Join(appDir, "Procfile"), []byte("web: ruby app.rb\n"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(layersDir, "config", "metadata.toml"), []byte(`
+[[processes]]
+type = "web"
+command = "watchdog"
+
+[[processes]]
+type = "web-upstream"
+command = "ruby app.rb"
+`), 0644)).To(Succeed())
+			env["OPENFAAS_PROCESS_TYPE"] = "web"
+
+			functionProcess, resolved, err := functionprocess.Resolve(env)
+			Expect(err).To(BeNil())
+			Expect(resolved).To(BeTrue())
+			Expect(functionProcess).To(Equal("/cnb/lifecycle/launcher web-upstream"))
+		})
+
+		It("fails when the selected process type runs the watchdog", func() {
+			env["OPENFAAS_PROCESS_TYPE"] = "faas"
+
+			_, _, err := functionprocess.Resolve(env)
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(Equal("OPENFAAS_PROCESS_TYPE 'faas' runs the watchdog itself"))
+		})
+	})
+
+	Describe("Expand", func() {
+		It("expands the launch-time references of the listed env vars", func() {
+			env["OPENFAAS_EXPAND_ENV"] = "upstream_url,exec_timeout"
+			env["upstream_url"] = "http://127.0.0.1:${PORT}"
+			env["exec_timeout"] = "${TIMEOUT:-10s}"
+			env["PORT"] = "3000"
+
+			expanded, err := functionprocess.Expand(env)
+			Expect(err).To(BeNil())
+			Expect(expanded).To(Equal(map[string]string{
+				"upstream_url": "http://127.0.0.1:3000",
+				"exec_timeout": "10s",
+			}))
+		})
+
+		It("expands nothing without listed env vars", func() {
+			expanded, err := functionprocess.Expand(env)
+			Expect(err).To(BeNil())
+			Expect(expanded).To(BeEmpty())
+		})
+
+		It("fails when a referenced variable is unset", func() {
+			env["OPENFAAS_EXPAND_ENV"] = "upstream_url"
+			env["upstream_url"] = "http://127.0.0.1:${PORT}"
+
+			_, err := functionprocess.Expand(env)
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(Equal("expanding upstream_url: variable 'PORT' is not set"))
+		})
+	})
+
+	Describe("Contribute", func() {
+		var (
+			lyrs       layers.Layers
+			helperPath string
+		)
+
+		BeforeEach(func() {
+			lyrs = layers.NewLayers(layersDir, logger.Logger{})
+			helperPath = filepath.Join(tmpDir, "function-process")
+			Expect(ioutil.WriteFile(helperPath, []byte("helper"), 0755)).To(Succeed())
+		})
+
+		It("copies the helper into a launch layer's exec.d", func() {
+			Expect(functionprocess.Contribute(logger.Logger{}, lyrs, launch.API{Major: 0, Minor: 6}, helperPath)).To(Succeed())
+
+			helper := filepath.Join(layersDir, "function-process", "exec.d", "function-process")
+			info, err := os.Stat(helper)
+			Expect(err).To(BeNil())
+			Expect(info.Mode().Perm() & 0100).ToNot(BeZero())
+			Expect(filepath.Join(layersDir, "function-process.toml")).To(BeARegularFile())
+		})
+
+		It("is skipped for buildpack APIs without exec.d", func() {
+			Expect(functionprocess.Contribute(logger.Logger{}, lyrs, launch.API{Major: 0, Minor: 6}, helperPath)).To(Succeed())
+
+			Expect(functionprocess.Contribute(logger.Logger{}, lyrs, launch.API{Major: 0, Minor: 2}, helperPath)).To(Succeed())
+			Expect(filepath.Join(layersDir, "function-process")).ToNot(BeAnExistingFile())
+			Expect(filepath.Join(layersDir, "function-process.toml")).ToNot(BeAnExistingFile())
+		})
+	})
+})
@@ -0,0 +1,86 @@
+package healthcheck
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/buildpacks/libbuildpack/v2/layers"
+
+	"github.com/jromero/openfaas-cnb/pkg/launch"
+)
+
+const (
+	// HelperName is the executable checking the watchdog's health.
+	HelperName = "healthcheck"
+
+	contributorName = "healthcheck"
+	processType     = "faas-healthcheck"
+	defaultPort     = 8080
+	lockFileName    = ".lock"
+)
+
+type HttpClient interface {
+	Get(url string) (*http.Response, error)
+}
+
+// Check checks the health of the watchdog listening on the port set by env, or by the first of args. Unless
+// suppress_lock is set, the watchdog is only healthy once it has written its lock file, as the watchdog's own
+// /_/health endpoint reports.
+func Check(env map[string]string, args []string, client HttpClient) error {
+	port := defaultPort
+	portValue := env["port"]
+	if len(args) > 0 {
+		portValue = args[0]
+	}
+	if portValue != "" {
+		var err error
+		if port, err = strconv.Atoi(portValue); err != nil {
+			return fmt.Errorf("invalid port '%s'", portValue)
+		}
+	}
+
+	if suppressLock, _ := strconv.ParseBool(env["suppress_lock"]); !suppressLock {
+		lockFile := filepath.Join(os.TempDir(), lockFileName)
+		if _, err := os.Stat(lockFile); err != nil {
+			return fmt.Errorf("lock file '%s' not found: %s", lockFile, err)
+		}
+	}
+
+	healthURL := fmt.Sprintf("http://127.0.0.1:%d/_/health", port)
+	resp, err := client.Get(healthURL)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("'%s' returned status code '%d'", healthURL, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Contribute copies the helper at helperPath into the watchdog layer, and adds the 'faas-healthcheck' process running
+// it to launchMetadata.
+func Contribute(watchdogLayer layers.Layer, launchMetadata *launch.Metadata, helperPath string) error {
+	helper := filepath.Join(watchdogLayer.Root, HelperName)
+	if err := launch.CopyFile(helperPath, helper); err != nil {
+		return errors.New("copying health-check: " + err.Error())
+	}
+
+	return launchMetadata.AddProcess(contributorName, layers.Process{
+		Type:    processType,
+		Command: helper,
+		Args:    nil,
+		Direct:  true,
+	})
+}
@@ -0,0 +1,122 @@
+package healthcheck_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buildpacks/libbuildpack/v2/layers"
+	"github.com/buildpacks/libbuildpack/v2/logger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/jromero/openfaas-cnb/pkg/healthcheck"
+	"github.com/jromero/openfaas-cnb/pkg/launch"
+)
+
+func TestHealthcheck(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Healthcheck")
+}
+
+var _ = Describe("Healthcheck", func() {
+	var (
+		tmpDir     string
+		prevTmpDir string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "")
+		Expect(err).To(BeNil())
+
+		// the lock file is looked up in the temporary directory
+		prevTmpDir = os.Getenv("TMPDIR")
+		Expect(os.Setenv("TMPDIR", tmpDir)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.Setenv("TMPDIR", prevTmpDir)).To(Succeed())
+		Expect(os.RemoveAll(tmpDir)).To(BeNil())
+	})
+
+	Describe("Check", func() {
+		var (
+			server     *httptest.Server
+			port       string
+			statusCode int
+		)
+
+		BeforeEach(func() {
+			statusCode = http.StatusOK
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).To(Equal("/_/health"))
+				w.WriteHeader(statusCode)
+			}))
+
+			serverURL, err := url.Parse(server.URL)
+			Expect(err).To(BeNil())
+			port = serverURL.Port()
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		writeLock := func() {
+			Expect(ioutil.WriteFile(filepath.Join(tmpDir, ".lock"), nil, 0644)).To(Succeed())
+		}
+
+		It("is healthy once the lock file is written", func() {
+			writeLock()
+			Expect(healthcheck.Check(map[string]string{"port": port}, nil, http.DefaultClient)).To(Succeed())
+		})
+
+		It("is unhealthy without the lock file", func() {
+			err := healthcheck.Check(map[string]string{"port": port}, nil, http.DefaultClient)
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(HavePrefix("lock file '" + filepath.Join(tmpDir, ".lock") + "' not found"))
+		})
+
+		It("ignores the lock file when it is suppressed", func() {
+			env := map[string]string{"port": port, "suppress_lock": "true"}
+			Expect(healthcheck.Check(env, nil, http.DefaultClient)).To(Succeed())
+		})
+
+		It("is unhealthy when the watchdog reports so", func() {
+			writeLock()
+			statusCode = http.StatusServiceUnavailable
+
+			err := healthcheck.Check(map[string]string{"port": "1"}, []string{port}, http.DefaultClient)
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(Equal("'http://127.0.0.1:" + port + "/_/health' returned status code '503'"))
+		})
+
+		It("fails on an invalid port", func() {
+			err := healthcheck.Check(map[string]string{"port": "http"}, nil, http.DefaultClient)
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(Equal("invalid port 'http'"))
+		})
+	})
+
+	Describe("Contribute", func() {
+		It("adds a 'faas-healthcheck' process running the helper from the watchdog layer", func() {
+			helperPath := filepath.Join(tmpDir, "healthcheck")
+			Expect(ioutil.WriteFile(helperPath, []byte("helper"), 0755)).To(Succeed())
+
+			lyrs := layers.NewLayers(filepath.Join(tmpDir, "layers"), logger.Logger{})
+			watchdogLayer := lyrs.Layer("watchdog")
+			Expect(os.MkdirAll(watchdogLayer.Root, os.ModePerm)).To(Succeed())
+
+			launchMetadata := launch.NewMetadata(launch.API{Major: 0, Minor: 6})
+			Expect(healthcheck.Contribute(watchdogLayer, launchMetadata, helperPath)).To(Succeed())
+
+			Expect(filepath.Join(watchdogLayer.Root, "healthcheck")).To(BeARegularFile())
+			Expect(launchMetadata.ProcessTypes()).To(Equal([]string{"faas-healthcheck"}))
+		})
+	})
+})
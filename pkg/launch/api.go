@@ -0,0 +1,81 @@
+package launch
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+var (
+	// BOMVersionAPI is the first buildpack API declaring the version of bill of materials entries in their metadata.
+	BOMVersionAPI = API{Major: 0, Minor: 5}
+	// BuildBOMAPI is the first buildpack API reading a bill of materials from build.toml.
+	BuildBOMAPI = API{Major: 0, Minor: 5}
+	// DefaultProcessAPI is the first buildpack API supporting a buildpack's default process.
+	DefaultProcessAPI = API{Major: 0, Minor: 6}
+	// ExecDAPI is the first buildpack API running the exec.d executables of launch layers.
+	ExecDAPI = API{Major: 0, Minor: 5}
+	// LabelsAPI is the first buildpack API adding labels to the application image.
+	LabelsAPI = API{Major: 0, Minor: 5}
+	// LayerTypesAPI is the first buildpack API declaring layer flags in a [types] table.
+	LayerTypesAPI = API{Major: 0, Minor: 6}
+	// ReadOnlyPlanAPI is the first buildpack API where the buildpack plan is read-only at build time, entries not met
+	// being declared as [[unmet]] in build.toml instead.
+	ReadOnlyPlanAPI = API{Major: 0, Minor: 5}
+	// SBOMAPI is the first buildpack API exporting the SBOM documents written alongside layers.
+	SBOMAPI = API{Major: 0, Minor: 7}
+	// WorkingDirAPI is the first buildpack API supporting a working directory per process.
+	WorkingDirAPI = API{Major: 0, Minor: 8}
+)
+
+// API is the buildpack API version declared by the buildpack, determining the launch features available.
+type API struct {
+	Major int
+	Minor int
+}
+
+// ParseAPI parses a '<major>.<minor>' buildpack API version.
+func ParseAPI(version string) (API, error) {
+	segments := strings.Split(version, ".")
+	if len(segments) != 2 {
+		return API{}, fmt.Errorf("invalid buildpack API '%s'", version)
+	}
+
+	major, err := strconv.Atoi(segments[0])
+	if err != nil {
+		return API{}, fmt.Errorf("invalid buildpack API '%s'", version)
+	}
+
+	minor, err := strconv.Atoi(segments[1])
+	if err != nil {
+		return API{}, fmt.Errorf("invalid buildpack API '%s'", version)
+	}
+
+	return API{Major: major, Minor: minor}, nil
+}
+
+// ReadAPI reads the buildpack API declared by the buildpack.toml in buildpackRoot.
+func ReadAPI(buildpackRoot string) (API, error) {
+	var buildpackTOML struct {
+		API string `toml:"api"`
+	}
+
+	path := filepath.Join(buildpackRoot, "buildpack.toml")
+	if _, err := toml.DecodeFile(path, &buildpackTOML); err != nil {
+		return API{}, fmt.Errorf("reading '%s': %s", path, err)
+	}
+
+	return ParseAPI(buildpackTOML.API)
+}
+
+// Supports reports whether a is the same as, or newer than, other.
+func (a API) Supports(other API) bool {
+	return a.Major > other.Major || (a.Major == other.Major && a.Minor >= other.Minor)
+}
+
+func (a API) String() string {
+	return fmt.Sprintf("%d.%d", a.Major, a.Minor)
+}
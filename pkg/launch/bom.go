@@ -0,0 +1,170 @@
+package launch
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/buildpacks/libbuildpack/v2/layers"
+)
+
+// cycloneDXName is the name of the CycloneDX SBOM written into each layer, and the extension of those written alongside
+// the layers from SBOMAPI.
+const cycloneDXName = "sbom.cdx.json"
+
+// BOMEntry describes a dependency installed into the image.
+type BOMEntry struct {
+	Name    string
+	Version string
+	Arch    string
+	// Source is the URL the dependency was downloaded from, if any.
+	Source  string
+	SHA256  string
+	License string
+}
+
+// bomTOML is a [[bom]] entry of launch.toml or build.toml. Before BOMVersionAPI, the version is declared at the top
+// level, since in its metadata.
+type bomTOML struct {
+	Name     string            `toml:"name"`
+	Version  string            `toml:"version,omitempty"`
+	Metadata map[string]string `toml:"metadata"`
+}
+
+type buildTOML struct {
+	BOM []bomTOML `toml:"bom"`
+}
+
+func (e BOMEntry) toml(api API) bomTOML {
+	md := map[string]string{}
+	for key, value := range map[string]string{
+		"arch":    e.Arch,
+		"uri":     e.Source,
+		"sha256":  e.SHA256,
+		"license": e.License,
+	} {
+		if value != "" {
+			md[key] = value
+		}
+	}
+
+	if !api.Supports(BOMVersionAPI) {
+		return bomTOML{Name: e.Name, Version: e.Version, Metadata: md}
+	}
+
+	md["version"] = e.Version
+	return bomTOML{Name: e.Name, Metadata: md}
+}
+
+// AddBOM adds entry to the bill of materials of both the application image and the build.
+func (m *Metadata) AddBOM(entry BOMEntry) {
+	m.bom = append(m.bom, entry)
+}
+
+func (m *Metadata) bomTOML() []bomTOML {
+	var entries []bomTOML
+	for _, entry := range m.bom {
+		entries = append(entries, entry.toml(m.api))
+	}
+
+	return entries
+}
+
+// writeBuildBOM writes the bill of materials to build.toml, which requires BuildBOMAPI.
+func (m *Metadata) writeBuildBOM(lyrs layers.Layers) error {
+	if len(m.bom) == 0 || !m.api.Supports(BuildBOMAPI) {
+		return nil
+	}
+
+	return writeTOML(filepath.Join(lyrs.Root, "build.toml"), buildTOML{BOM: m.bomTOML()})
+}
+
+type cycloneDX struct {
+	BOMFormat   string               `json:"bomFormat"`
+	SpecVersion string               `json:"specVersion"`
+	Version     int                  `json:"version"`
+	Components  []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXComponent struct {
+	Type               string                       `json:"type"`
+	Name               string                       `json:"name"`
+	Version            string                       `json:"version"`
+	Hashes             []cycloneDXHash              `json:"hashes,omitempty"`
+	Licenses           []cycloneDXLicense           `json:"licenses,omitempty"`
+	ExternalReferences []cycloneDXExternalReference `json:"externalReferences,omitempty"`
+	Properties         []cycloneDXProperty          `json:"properties,omitempty"`
+}
+
+type cycloneDXHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cycloneDXLicense struct {
+	License struct {
+		ID string `json:"id"`
+	} `json:"license"`
+}
+
+type cycloneDXExternalReference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// WriteLayerSBOM writes a CycloneDX SBOM of entries into layer, so that it is part of the image, and from SBOMAPI also
+// alongside it, where the lifecycle exports it as the layer's SBOM.
+func WriteLayerSBOM(lyrs layers.Layers, layer layers.Layer, api API, entries ...BOMEntry) error {
+	doc := cycloneDX{BOMFormat: "CycloneDX", SpecVersion: "1.3", Version: 1, Components: []cycloneDXComponent{}}
+	for _, entry := range entries {
+		component := cycloneDXComponent{Type: "application", Name: entry.Name, Version: entry.Version}
+		if entry.SHA256 != "" {
+			component.Hashes = append(component.Hashes, cycloneDXHash{Alg: "SHA-256", Content: entry.SHA256})
+		}
+		if entry.License != "" {
+			license := cycloneDXLicense{}
+			license.License.ID = entry.License
+			component.Licenses = append(component.Licenses, license)
+		}
+		if entry.Source != "" {
+			component.ExternalReferences = append(component.ExternalReferences, cycloneDXExternalReference{
+				Type: "distribution",
+				URL:  entry.Source,
+			})
+		}
+		if entry.Arch != "" {
+			component.Properties = append(component.Properties, cycloneDXProperty{Name: "arch", Value: entry.Arch})
+		}
+		doc.Components = append(doc.Components, component)
+	}
+
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(layer.Root, os.ModePerm); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(layer.Root, cycloneDXName), b, 0644); err != nil {
+		return errors.New("writing layer SBOM: " + err.Error())
+	}
+
+	if !api.Supports(SBOMAPI) {
+		return nil
+	}
+
+	path := filepath.Join(lyrs.Root, filepath.Base(layer.Root)+"."+cycloneDXName)
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return errors.New("writing layer SBOM: " + err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package launch
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/buildpacks/libbuildpack/v2/layers"
+)
+
+// RemoveLayer removes layer and its metadata, so that a layer from a previous build isn't restored or reused.
+func RemoveLayer(layer layers.Layer) error {
+	if err := os.RemoveAll(layer.Root); err != nil {
+		return err
+	}
+
+	if err := os.Remove(layer.Metadata); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// ContributeExecD copies the helper at helperPath into layer as the exec.d executable name, run by the launcher before
+// the process starts, and makes it a launch layer. It requires ExecDAPI.
+func ContributeExecD(layer layers.Layer, api API, name string, helperPath string) error {
+	if !api.Supports(ExecDAPI) {
+		return fmt.Errorf("exec.d requires buildpack API %s or later, the buildpack declares %s", ExecDAPI, api)
+	}
+
+	if err := CopyFile(helperPath, filepath.Join(layer.Root, "exec.d", name)); err != nil {
+		return errors.New("copying helper: " + err.Error())
+	}
+
+	if err := WriteLayerMetadata(layer, api, map[string]string{}, layers.Launch); err != nil {
+		return errors.New("writing metadata: " + err.Error())
+	}
+
+	return nil
+}
+
+// WriteExecDEnv writes env to w as the output of an exec.d executable, a TOML table of environment variables.
+func WriteExecDEnv(w io.Writer, env map[string]string) error {
+	return toml.NewEncoder(w).Encode(env)
+}
+
+// CopyFile copies the executable at src to dst, creating its directory.
+func CopyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
@@ -0,0 +1,167 @@
+package launch
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/buildpacks/libbuildpack/v2/layers"
+)
+
+// Metadata accumulates the bill of materials, labels, processes and slices contributed to the application's launch
+// metadata, so that it is written once, after every contributor has run.
+type Metadata struct {
+	api       API
+	processes layers.Processes
+	slices    layers.Slices
+	// contributors are the names of the contributors of each process type.
+	contributors map[string]string
+	// defaultType is the process type launched by default, if any.
+	defaultType string
+	labels      map[string]string
+	bom         []BOMEntry
+	// workingDirs are the working directories of process types, by type.
+	workingDirs map[string]string
+}
+
+// process is a layers.Process with the fields of newer buildpack APIs.
+type process struct {
+	Type    string   `toml:"type"`
+	Command string   `toml:"command"`
+	Args    []string `toml:"args"`
+	Direct  bool     `toml:"direct"`
+	Default bool     `toml:"default,omitempty"`
+	// WorkingDir is the directory the process is started in, absolute or relative to the application.
+	WorkingDir string `toml:"working-dir,omitempty"`
+}
+
+type label struct {
+	Key   string `toml:"key"`
+	Value string `toml:"value"`
+}
+
+type launchTOML struct {
+	BOM       []bomTOML     `toml:"bom,omitempty"`
+	Labels    []label       `toml:"labels,omitempty"`
+	Processes []process     `toml:"processes"`
+	Slices    layers.Slices `toml:"slices"`
+}
+
+// NewMetadata returns launch metadata written for the buildpack API api.
+func NewMetadata(api API) *Metadata {
+	return &Metadata{
+		api:          api,
+		contributors: map[string]string{},
+		labels:       map[string]string{},
+		workingDirs:  map[string]string{},
+	}
+}
+
+// API returns the buildpack API the launch metadata, and the layers contributing to it, are written for.
+func (m *Metadata) API() API {
+	return m.api
+}
+
+// AddProcess adds process on behalf of contributor, failing when its type has already been added.
+func (m *Metadata) AddProcess(contributor string, process layers.Process) error {
+	if previous, ok := m.contributors[process.Type]; ok {
+		return fmt.Errorf(
+			"process type '%s' contributed by %s is already contributed by %s", process.Type, contributor, previous,
+		)
+	}
+
+	m.contributors[process.Type] = contributor
+	m.processes = append(m.processes, process)
+	return nil
+}
+
+// SetDefault makes the process of processType the one launched by default, which requires DefaultProcessAPI.
+func (m *Metadata) SetDefault(processType string) error {
+	if !m.api.Supports(DefaultProcessAPI) {
+		return fmt.Errorf(
+			"a default process requires buildpack API %s or later, the buildpack declares %s", DefaultProcessAPI, m.api,
+		)
+	}
+
+	if _, ok := m.contributors[processType]; !ok {
+		return fmt.Errorf("default process type '%s' has not been contributed", processType)
+	}
+
+	m.defaultType = processType
+	return nil
+}
+
+// SetWorkingDir makes the process of processType start in dir, which requires WorkingDirAPI.
+func (m *Metadata) SetWorkingDir(processType string, dir string) error {
+	if !m.api.Supports(WorkingDirAPI) {
+		return fmt.Errorf(
+			"a process working directory requires buildpack API %s or later, the buildpack declares %s", WorkingDirAPI, m.api,
+		)
+	}
+
+	if _, ok := m.contributors[processType]; !ok {
+		return fmt.Errorf("process type '%s' has not been contributed", processType)
+	}
+
+	m.workingDirs[processType] = dir
+	return nil
+}
+
+// AddSlice adds slice to the application's slices.
+func (m *Metadata) AddSlice(slice layers.Slice) {
+	m.slices = append(m.slices, slice)
+}
+
+// AddLabel adds a label to the application image, replacing any previous value of key, which requires LabelsAPI.
+func (m *Metadata) AddLabel(key string, value string) error {
+	if !m.api.Supports(LabelsAPI) {
+		return fmt.Errorf("image labels require buildpack API %s or later, the buildpack declares %s", LabelsAPI, m.api)
+	}
+
+	m.labels[key] = value
+	return nil
+}
+
+// ProcessTypes returns the types of the processes added, in order.
+func (m *Metadata) ProcessTypes() []string {
+	var types []string
+	for _, process := range m.processes {
+		types = append(types, process.Type)
+	}
+
+	return types
+}
+
+// Write writes the accumulated bill of materials, labels, processes and slices to the application's launch metadata,
+// and the bill of materials to the build metadata.
+func (m *Metadata) Write(lyrs layers.Layers) error {
+	md := launchTOML{BOM: m.bomTOML(), Slices: m.slices}
+	for key, value := range m.labels {
+		md.Labels = append(md.Labels, label{Key: key, Value: value})
+	}
+	sort.Slice(md.Labels, func(i, j int) bool {
+		return md.Labels[i].Key < md.Labels[j].Key
+	})
+
+	for _, p := range m.processes {
+		md.Processes = append(md.Processes, process{
+			Type:       p.Type,
+			Command:    p.Command,
+			Args:       p.Args,
+			Direct:     p.Direct,
+			Default:    p.Type == m.defaultType,
+			WorkingDir: m.workingDirs[p.Type],
+		})
+	}
+
+	if err := writeTOML(filepath.Join(lyrs.Root, "launch.toml"), md); err != nil {
+		return errors.New("writing app metadata file: " + err.Error())
+	}
+
+	if err := m.writeBuildBOM(lyrs); err != nil {
+		return errors.New("writing build metadata file: " + err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,348 @@
+package launch_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/buildpacks/libbuildpack/v2/buildpackplan"
+	"github.com/buildpacks/libbuildpack/v2/layers"
+	"github.com/buildpacks/libbuildpack/v2/logger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/jromero/openfaas-cnb/pkg/launch"
+)
+
+func TestLaunch(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Launch")
+}
+
+var _ = Describe("Launch", func() {
+	var (
+		tmpDir         string
+		lyrs           layers.Layers
+		launchMetadata *launch.Metadata
+		api            = launch.API{Major: 0, Minor: 6}
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "")
+		Expect(err).To(BeNil())
+
+		lyrs = layers.NewLayers(tmpDir, logger.Logger{})
+		launchMetadata = launch.NewMetadata(api)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(BeNil())
+	})
+
+	It("writes the processes and slices of every contributor", func() {
+		Expect(launchMetadata.AddProcess("shim", layers.Process{Type: "function", Command: "node index.js"})).To(Succeed())
+		Expect(launchMetadata.AddProcess("watchdog", layers.Process{Type: "faas", Command: "watchdog"})).To(Succeed())
+		launchMetadata.AddSlice(layers.Slice{Paths: []string{"function/**"}})
+
+		Expect(launchMetadata.ProcessTypes()).To(Equal([]string{"function", "faas"}))
+		Expect(launchMetadata.Write(lyrs)).To(Succeed())
+
+		md := &layers.Metadata{}
+		_, err := toml.DecodeFile(filepath.Join(lyrs.Root, "launch.toml"), md)
+		Expect(err).To(BeNil())
+		Expect(md).To(Equal(&layers.Metadata{
+			Processes: layers.Processes{
+				{Type: "function", Command: "node index.js"},
+				{Type: "faas", Command: "watchdog"},
+			},
+			Slices: layers.Slices{{Paths: []string{"function/**"}}},
+		}))
+	})
+
+	It("marks the default process", func() {
+		Expect(launchMetadata.AddProcess("watchdog", layers.Process{Type: "faas", Command: "watchdog"})).To(Succeed())
+		Expect(launchMetadata.SetDefault("faas")).To(Succeed())
+		Expect(launchMetadata.Write(lyrs)).To(Succeed())
+
+		b, err := ioutil.ReadFile(filepath.Join(lyrs.Root, "launch.toml"))
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(ContainSubstring("default = true"))
+	})
+
+	It("requires a newer buildpack API for a default process", func() {
+		launchMetadata = launch.NewMetadata(launch.API{Major: 0, Minor: 2})
+		Expect(launchMetadata.AddProcess("watchdog", layers.Process{Type: "faas", Command: "watchdog"})).To(Succeed())
+
+		err := launchMetadata.SetDefault("faas")
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(Equal("a default process requires buildpack API 0.6 or later, the buildpack declares 0.2"))
+	})
+
+	It("writes the working directory of processes", func() {
+		launchMetadata = launch.NewMetadata(launch.API{Major: 0, Minor: 8})
+		Expect(launchMetadata.AddProcess("watchdog", layers.Process{Type: "faas", Command: "watchdog"})).To(Succeed())
+		Expect(launchMetadata.SetWorkingDir("faas", "function")).To(Succeed())
+		Expect(launchMetadata.Write(lyrs)).To(Succeed())
+
+		b, err := ioutil.ReadFile(filepath.Join(lyrs.Root, "launch.toml"))
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(ContainSubstring(`working-dir = "function"`))
+	})
+
+	It("requires a newer buildpack API for a process working directory", func() {
+		Expect(launchMetadata.AddProcess("watchdog", layers.Process{Type: "faas", Command: "watchdog"})).To(Succeed())
+
+		err := launchMetadata.SetWorkingDir("faas", "function")
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(Equal("a process working directory requires buildpack API 0.8 or later, the buildpack declares 0.6"))
+	})
+
+	It("reports duplicate process types", func() {
+		Expect(launchMetadata.AddProcess("shim", layers.Process{Type: "faas", Command: "node index.js"})).To(Succeed())
+
+		err := launchMetadata.AddProcess("watchdog", layers.Process{Type: "faas", Command: "watchdog"})
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(Equal("process type 'faas' contributed by watchdog is already contributed by shim"))
+		Expect(launchMetadata.ProcessTypes()).To(Equal([]string{"faas"}))
+	})
+
+	It("writes the labels sorted by key", func() {
+		Expect(launchMetadata.AddLabel("com.openfaas.scale.min", "1")).To(Succeed())
+		Expect(launchMetadata.AddLabel("codes.jromero.openfaas.watchdog.version", "0.7.6")).To(Succeed())
+		Expect(launchMetadata.AddLabel("com.openfaas.scale.min", "2")).To(Succeed())
+		Expect(launchMetadata.Write(lyrs)).To(Succeed())
+
+		b, err := ioutil.ReadFile(filepath.Join(lyrs.Root, "launch.toml"))
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(HavePrefix(`[[labels]]
+  key = "codes.jromero.openfaas.watchdog.version"
+  value = "0.7.6"
+
+[[labels]]
+  key = "com.openfaas.scale.min"
+  value = "2"
+`))
+	})
+
+	It("requires a newer buildpack API for labels", func() {
+		launchMetadata = launch.NewMetadata(launch.API{Major: 0, Minor: 4})
+
+		err := launchMetadata.AddLabel("com.openfaas.scale.min", "1")
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(Equal("image labels require buildpack API 0.5 or later, the buildpack declares 0.4"))
+	})
+
+	Describe("BOM", func() {
+		entry := launch.BOMEntry{
+			Name:    "of-watchdog",
+			Version: "0.7.6",
+			Arch:    "amd64",
+			Source:  "https://example.com/of-watchdog",
+			SHA256:  "abc123",
+			License: "MIT",
+		}
+
+		It("writes the entries to the launch and build metadata", func() {
+			launchMetadata.AddBOM(entry)
+			Expect(launchMetadata.Write(lyrs)).To(Succeed())
+
+			expected := `[[bom]]
+  name = "of-watchdog"
+  [bom.metadata]
+    arch = "amd64"
+    license = "MIT"
+    sha256 = "abc123"
+    uri = "https://example.com/of-watchdog"
+    version = "0.7.6"
+`
+			b, err := ioutil.ReadFile(filepath.Join(lyrs.Root, "launch.toml"))
+			Expect(err).To(BeNil())
+			Expect(string(b)).To(HavePrefix(expected))
+
+			b, err = ioutil.ReadFile(filepath.Join(lyrs.Root, "build.toml"))
+			Expect(err).To(BeNil())
+			Expect(string(b)).To(Equal(expected))
+		})
+
+		It("declares the version at the top level for older APIs", func() {
+			launchMetadata = launch.NewMetadata(launch.API{Major: 0, Minor: 4})
+			launchMetadata.AddBOM(entry)
+			Expect(launchMetadata.Write(lyrs)).To(Succeed())
+
+			b, err := ioutil.ReadFile(filepath.Join(lyrs.Root, "launch.toml"))
+			Expect(err).To(BeNil())
+			Expect(string(b)).To(HavePrefix("[[bom]]\n  name = \"of-watchdog\"\n  version = \"0.7.6\"\n"))
+			Expect(filepath.Join(lyrs.Root, "build.toml")).ToNot(BeAnExistingFile())
+		})
+
+		It("doesn't write build metadata without entries", func() {
+			Expect(launchMetadata.Write(lyrs)).To(Succeed())
+			Expect(filepath.Join(lyrs.Root, "build.toml")).ToNot(BeAnExistingFile())
+		})
+
+		Describe("WriteLayerSBOM", func() {
+			It("writes a CycloneDX SBOM into the layer", func() {
+				layer := lyrs.Layer("test")
+				Expect(launch.WriteLayerSBOM(lyrs, layer, api, entry)).To(Succeed())
+
+				b, err := ioutil.ReadFile(filepath.Join(layer.Root, "sbom.cdx.json"))
+				Expect(err).To(BeNil())
+				Expect(string(b)).To(MatchJSON(`{
+  "bomFormat": "CycloneDX",
+  "specVersion": "1.3",
+  "version": 1,
+  "components": [
+    {
+      "type": "application",
+      "name": "of-watchdog",
+      "version": "0.7.6",
+      "hashes": [{"alg": "SHA-256", "content": "abc123"}],
+      "licenses": [{"license": {"id": "MIT"}}],
+      "externalReferences": [{"type": "distribution", "url": "https://example.com/of-watchdog"}],
+      "properties": [{"name": "arch", "value": "amd64"}]
+    }
+  ]
+}`))
+				Expect(filepath.Join(lyrs.Root, "test.sbom.cdx.json")).ToNot(BeAnExistingFile())
+			})
+
+			It("also writes it alongside the layer for newer APIs", func() {
+				layer := lyrs.Layer("test")
+				Expect(launch.WriteLayerSBOM(lyrs, layer, launch.API{Major: 0, Minor: 7}, entry)).To(Succeed())
+
+				inLayer, err := ioutil.ReadFile(filepath.Join(layer.Root, "sbom.cdx.json"))
+				Expect(err).To(BeNil())
+				alongside, err := ioutil.ReadFile(filepath.Join(lyrs.Root, "test.sbom.cdx.json"))
+				Expect(err).To(BeNil())
+				Expect(alongside).To(Equal(inLayer))
+			})
+		})
+	})
+
+	Describe("API", func() {
+		It("reads the API declared by buildpack.toml", func() {
+			Expect(ioutil.WriteFile(filepath.Join(tmpDir, "buildpack.toml"), []byte(`api = "0.6"`), 0644)).To(Succeed())
+
+			api, err := launch.ReadAPI(tmpDir)
+			Expect(err).To(BeNil())
+			Expect(api).To(Equal(launch.API{Major: 0, Minor: 6}))
+			Expect(api.String()).To(Equal("0.6"))
+		})
+
+		It("fails on an invalid API", func() {
+			_, err := launch.ParseAPI("0.x")
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(Equal("invalid buildpack API '0.x'"))
+		})
+
+		It("supports the features of older APIs", func() {
+			Expect(launch.API{Major: 0, Minor: 6}.Supports(launch.API{Major: 0, Minor: 2})).To(BeTrue())
+			Expect(launch.API{Major: 0, Minor: 6}.Supports(launch.API{Major: 0, Minor: 6})).To(BeTrue())
+			Expect(launch.API{Major: 0, Minor: 5}.Supports(launch.API{Major: 0, Minor: 6})).To(BeFalse())
+			Expect(launch.API{Major: 1, Minor: 0}.Supports(launch.API{Major: 0, Minor: 6})).To(BeTrue())
+		})
+	})
+
+	Describe("WritePlan", func() {
+		var (
+			written []buildpackplan.Plans
+			entry   = buildpackplan.Plan{Name: "openfaas-watchdog", Version: "0.7.6"}
+		)
+
+		writer := func(plans buildpackplan.Plans) error {
+			written = append(written, plans)
+			return nil
+		}
+
+		BeforeEach(func() {
+			written = nil
+		})
+
+		It("writes the entries met before ReadOnlyPlanAPI", func() {
+			Expect(launch.WritePlan(writer, launch.API{Major: 0, Minor: 4}, entry)).To(Succeed())
+			Expect(written).To(Equal([]buildpackplan.Plans{{Entries: []buildpackplan.Plan{entry}}}))
+		})
+
+		It("doesn't write the read-only plan from ReadOnlyPlanAPI", func() {
+			Expect(launch.WritePlan(writer, launch.ReadOnlyPlanAPI, entry)).To(Succeed())
+			Expect(written).To(BeEmpty())
+		})
+	})
+
+	Describe("WriteLayerMetadata", func() {
+		It("declares the flags in a [types] table", func() {
+			layer := lyrs.Layer("test")
+			Expect(launch.WriteLayerMetadata(layer, api, map[string]string{"key": "value"}, layers.Launch)).To(Succeed())
+
+			b, err := ioutil.ReadFile(layer.Metadata)
+			Expect(err).To(BeNil())
+			Expect(string(b)).To(Equal(`[types]
+  build = false
+  cache = false
+  launch = true
+
+[metadata]
+  key = "value"
+`))
+		})
+
+		It("declares the flags at the top level for older APIs", func() {
+			layer := lyrs.Layer("test")
+			Expect(launch.WriteLayerMetadata(layer, launch.API{Major: 0, Minor: 2}, map[string]string{}, layers.Launch)).To(Succeed())
+
+			b, err := ioutil.ReadFile(layer.Metadata)
+			Expect(err).To(BeNil())
+			Expect(string(b)).To(HavePrefix("build = false\ncache = false\nlaunch = true\n"))
+		})
+	})
+
+	Describe("exec.d", func() {
+		var helperPath string
+
+		BeforeEach(func() {
+			helperPath = filepath.Join(tmpDir, "bin", "helper")
+			Expect(os.MkdirAll(filepath.Dir(helperPath), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(helperPath, []byte("helper"), 0755)).To(Succeed())
+		})
+
+		It("copies the helper into a launch layer's exec.d", func() {
+			layer := lyrs.Layer("helper")
+			Expect(launch.ContributeExecD(layer, api, "helper", helperPath)).To(Succeed())
+
+			info, err := os.Stat(filepath.Join(layer.Root, "exec.d", "helper"))
+			Expect(err).To(BeNil())
+			Expect(info.Mode().Perm() & 0100).ToNot(BeZero())
+
+			b, err := ioutil.ReadFile(layer.Metadata)
+			Expect(err).To(BeNil())
+			Expect(string(b)).To(ContainSubstring("launch = true"))
+		})
+
+		It("requires a buildpack API supporting exec.d", func() {
+			err := launch.ContributeExecD(lyrs.Layer("helper"), launch.API{Major: 0, Minor: 4}, "helper", helperPath)
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(Equal("exec.d requires buildpack API 0.5 or later, the buildpack declares 0.4"))
+		})
+
+		It("removes a previous layer and its metadata", func() {
+			layer := lyrs.Layer("helper")
+			Expect(launch.ContributeExecD(layer, api, "helper", helperPath)).To(Succeed())
+
+			Expect(launch.RemoveLayer(layer)).To(Succeed())
+			Expect(layer.Root).ToNot(BeAnExistingFile())
+			Expect(layer.Metadata).ToNot(BeAnExistingFile())
+
+			Expect(launch.RemoveLayer(layer)).To(Succeed())
+		})
+
+		It("writes env vars as the exec.d output", func() {
+			buf := &bytes.Buffer{}
+			Expect(launch.WriteExecDEnv(buf, map[string]string{"DATABASE_PASSWORD": "s3cret"})).To(Succeed())
+			Expect(buf.String()).To(Equal("DATABASE_PASSWORD = \"s3cret\"\n"))
+		})
+	})
+})
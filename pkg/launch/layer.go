@@ -0,0 +1,56 @@
+package launch
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/buildpacks/libbuildpack/v2/layers"
+)
+
+type layerTypes struct {
+	Build  bool `toml:"build"`
+	Cache  bool `toml:"cache"`
+	Launch bool `toml:"launch"`
+}
+
+type layerTOML struct {
+	Types    layerTypes  `toml:"types"`
+	Metadata interface{} `toml:"metadata"`
+}
+
+// WriteLayerMetadata writes the metadata and flags of layer, declaring the flags as api requires: at the top level
+// before LayerTypesAPI, in a [types] table since.
+func WriteLayerMetadata(layer layers.Layer, api API, metadata interface{}, flags ...layers.Flag) error {
+	if !api.Supports(LayerTypesAPI) {
+		return layer.WriteMetadata(metadata, flags...)
+	}
+
+	types := layerTypes{}
+	for _, flag := range flags {
+		switch flag {
+		case layers.Build:
+			types.Build = true
+		case layers.Cache:
+			types.Cache = true
+		case layers.Launch:
+			types.Launch = true
+		}
+	}
+
+	return writeTOML(layer.Metadata, layerTOML{Types: types, Metadata: metadata})
+}
+
+func writeTOML(path string, value interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	fh, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	return toml.NewEncoder(fh).Encode(value)
+}
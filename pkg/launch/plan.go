@@ -0,0 +1,15 @@
+package launch
+
+import (
+	"github.com/buildpacks/libbuildpack/v2/buildpackplan"
+)
+
+// WritePlan writes entries, the build plan entries met by the build, with writer. The plan is only written before
+// ReadOnlyPlanAPI: from then on it is read-only, and every entry is met unless declared as [[unmet]] in build.toml.
+func WritePlan(writer buildpackplan.Writer, api API, entries ...buildpackplan.Plan) error {
+	if api.Supports(ReadOnlyPlanAPI) {
+		return nil
+	}
+
+	return writer(buildpackplan.Plans{Entries: entries})
+}
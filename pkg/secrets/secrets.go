@@ -0,0 +1,132 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/buildpacks/libbuildpack/v2/layers"
+	"github.com/buildpacks/libbuildpack/v2/logger"
+
+	"github.com/jromero/openfaas-cnb/pkg/launch"
+	"github.com/jromero/openfaas-cnb/pkg/watchdog"
+)
+
+const (
+	// DefaultDir is the directory OpenFaaS mounts the function's secrets into, one file per secret.
+	DefaultDir = "/var/openfaas/secrets"
+	// HelperName is the exec.d helper exporting secrets.
+	HelperName = "secrets"
+	// ConfigName is the name of the file, at the root of the helper's layer, declaring the secrets to export.
+	ConfigName = "secrets.toml"
+
+	layerName = "secrets"
+)
+
+// Secret is a secret exported to the environment variable Env when the container starts.
+type Secret struct {
+	Name     string `toml:"name"`
+	Env      string `toml:"env"`
+	Optional bool   `toml:"optional"`
+}
+
+type secretsTOML struct {
+	Secrets []Secret `toml:"secrets"`
+}
+
+// FromConfig returns the secrets declared by conf, sorted by name.
+func FromConfig(conf watchdog.Config) []Secret {
+	optional := map[string]bool{}
+	for _, name := range conf.OptionalSecrets {
+		optional[name] = true
+	}
+
+	var secrets []Secret
+	for name, env := range conf.Secrets {
+		secrets = append(secrets, Secret{Name: name, Env: env, Optional: optional[name]})
+	}
+
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i].Name < secrets[j].Name
+	})
+
+	return secrets
+}
+
+// ReadConfig reads the secrets declared at path, written by Contribute.
+func ReadConfig(path string) ([]Secret, error) {
+	sTOML := &secretsTOML{}
+	if _, err := toml.DecodeFile(path, sTOML); err != nil {
+		return nil, fmt.Errorf("reading '%s': %s", path, err)
+	}
+
+	return sTOML.Secrets, nil
+}
+
+// Resolve reads each of secrets from its file in dir, returning their values by environment variable and the names of
+// the optional secrets that are missing. A missing secret that isn't optional fails. Errors never include values.
+func Resolve(dir string, secrets []Secret) (map[string]string, []string, error) {
+	env := map[string]string{}
+	var missing []string
+	for _, secret := range secrets {
+		path := filepath.Join(dir, secret.Name)
+		b, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			if secret.Optional {
+				missing = append(missing, secret.Name)
+				continue
+			}
+
+			return nil, nil, fmt.Errorf("secret '%s' for %s not found at '%s'", secret.Name, secret.Env, path)
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("reading secret '%s' for %s: %s", secret.Name, secret.Env, err)
+		}
+
+		env[secret.Env] = strings.TrimSpace(string(b))
+	}
+
+	return env, missing, nil
+}
+
+// Contribute copies the helper at helperPath into a launch layer as an exec.d executable, alongside the secrets it
+// exports when the container starts. It requires launch.ExecDAPI, so fails for older buildpack APIs when secrets are
+// declared.
+func Contribute(log logger.Logger, lyrs layers.Layers, api launch.API, helperPath string, secrets []Secret) error {
+	helperLayer := lyrs.Layer(layerName)
+	if err := launch.RemoveLayer(helperLayer); err != nil {
+		return errors.New("removing previous helper: " + err.Error())
+	}
+
+	if len(secrets) == 0 {
+		return nil
+	}
+
+	if !api.Supports(launch.ExecDAPI) {
+		return fmt.Errorf("secrets require buildpack API %s or later, the buildpack declares %s", launch.ExecDAPI, api)
+	}
+
+	for _, secret := range secrets {
+		log.Debug("secret '%s' will be exported as %s", secret.Name, secret.Env)
+	}
+
+	if err := launch.ContributeExecD(helperLayer, api, HelperName, helperPath); err != nil {
+		return err
+	}
+
+	fh, err := os.Create(filepath.Join(helperLayer.Root, ConfigName))
+	if err != nil {
+		return errors.New("writing secrets: " + err.Error())
+	}
+	defer fh.Close()
+
+	if err := toml.NewEncoder(fh).Encode(secretsTOML{Secrets: secrets}); err != nil {
+		return errors.New("writing secrets: " + err.Error())
+	}
+
+	return nil
+}
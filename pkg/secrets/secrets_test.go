@@ -0,0 +1,124 @@
+package secrets_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buildpacks/libbuildpack/v2/layers"
+	"github.com/buildpacks/libbuildpack/v2/logger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/jromero/openfaas-cnb/pkg/launch"
+	"github.com/jromero/openfaas-cnb/pkg/secrets"
+	"github.com/jromero/openfaas-cnb/pkg/watchdog"
+)
+
+func TestSecrets(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Secrets")
+}
+
+var _ = Describe("Secrets", func() {
+	var (
+		tmpDir     string
+		secretsDir string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "")
+		Expect(err).To(BeNil())
+
+		secretsDir = filepath.Join(tmpDir, "secrets")
+		Expect(os.MkdirAll(secretsDir, os.ModePerm)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(BeNil())
+	})
+
+	writeSecret := func(name, value string) {
+		Expect(ioutil.WriteFile(filepath.Join(secretsDir, name), []byte(value), 0600)).To(Succeed())
+	}
+
+	Describe("FromConfig", func() {
+		It("returns the secrets sorted by name", func() {
+			Expect(secrets.FromConfig(watchdog.Config{
+				Secrets:         map[string]string{"db-password": "DATABASE_PASSWORD", "api-key": "API_KEY"},
+				OptionalSecrets: []string{"api-key"},
+			})).To(Equal([]secrets.Secret{
+				{Name: "api-key", Env: "API_KEY", Optional: true},
+				{Name: "db-password", Env: "DATABASE_PASSWORD"},
+			}))
+		})
+	})
+
+	Describe("Resolve", func() {
+		It("reads each secret, without surrounding whitespace", func() {
+			writeSecret("db-password", "s3cret\n")
+
+			env, missing, err := secrets.Resolve(secretsDir, []secrets.Secret{{Name: "db-password", Env: "DATABASE_PASSWORD"}})
+			Expect(err).To(BeNil())
+			Expect(env).To(Equal(map[string]string{"DATABASE_PASSWORD": "s3cret"}))
+			Expect(missing).To(BeEmpty())
+		})
+
+		It("skips missing optional secrets", func() {
+			env, missing, err := secrets.Resolve(secretsDir, []secrets.Secret{{Name: "api-key", Env: "API_KEY", Optional: true}})
+			Expect(err).To(BeNil())
+			Expect(env).To(BeEmpty())
+			Expect(missing).To(Equal([]string{"api-key"}))
+		})
+
+		It("fails for missing secrets", func() {
+			_, _, err := secrets.Resolve(secretsDir, []secrets.Secret{{Name: "db-password", Env: "DATABASE_PASSWORD"}})
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(Equal(
+				"secret 'db-password' for DATABASE_PASSWORD not found at '" + filepath.Join(secretsDir, "db-password") + "'",
+			))
+		})
+	})
+
+	Describe("Contribute", func() {
+		var (
+			lyrs       layers.Layers
+			helperPath string
+			declared   = []secrets.Secret{{Name: "db-password", Env: "DATABASE_PASSWORD"}}
+		)
+
+		BeforeEach(func() {
+			lyrs = layers.NewLayers(filepath.Join(tmpDir, "layers"), logger.Logger{})
+
+			helperPath = filepath.Join(tmpDir, "helper")
+			Expect(ioutil.WriteFile(helperPath, []byte("helper"), 0755)).To(Succeed())
+		})
+
+		It("installs the helper as an exec.d executable, with the secrets it exports", func() {
+			Expect(secrets.Contribute(logger.Logger{}, lyrs, launch.API{Major: 0, Minor: 6}, helperPath, declared)).To(Succeed())
+
+			helperLayer := lyrs.Layer("secrets")
+			info, err := os.Stat(filepath.Join(helperLayer.Root, "exec.d", "secrets"))
+			Expect(err).To(BeNil())
+			Expect(info.Mode().Perm() & 0111).ToNot(BeZero())
+
+			read, err := secrets.ReadConfig(filepath.Join(helperLayer.Root, secrets.ConfigName))
+			Expect(err).To(BeNil())
+			Expect(read).To(Equal(declared))
+			Expect(helperLayer.Metadata).To(BeAnExistingFile())
+		})
+
+		It("doesn't install the helper without secrets", func() {
+			Expect(secrets.Contribute(logger.Logger{}, lyrs, launch.API{Major: 0, Minor: 6}, helperPath, nil)).To(Succeed())
+			Expect(lyrs.Layer("secrets").Root).ToNot(BeAnExistingFile())
+		})
+
+		It("requires a buildpack API supporting exec.d", func() {
+			err := secrets.Contribute(logger.Logger{}, lyrs, launch.API{Major: 0, Minor: 4}, helperPath, declared)
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(Equal("secrets require buildpack API 0.5 or later, the buildpack declares 0.4"))
+		})
+	})
+})
@@ -0,0 +1,158 @@
+package shim
+
+// goStdinMain is the entrypoint of the classic 'go' template, reading the request from stdin.
+const goStdinMain = `// {{.Header}}
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"{{.Module}}/function"
+)
+
+func main() {
+	input, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		log.Fatalf("Unable to read standard input: %s", err.Error())
+	}
+
+	fmt.Println(function.Handle(input))
+}
+`
+
+// goMiddlewareMain is the entrypoint of the 'golang-middleware' template, serving the handler's http.HandlerFunc.
+const goMiddlewareMain = `// {{.Header}}
+
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"{{.Module}}/function"
+)
+
+func main() {
+	http.HandleFunc("/", function.Handle)
+
+	log.Fatal(http.ListenAndServe("127.0.0.1:{{.Port}}", nil))
+}
+`
+
+// goHTTPMain is the entrypoint of the 'golang-http' template, serving the handler with handler.Request and
+// handler.Response.
+const goHTTPMain = `// {{.Header}}
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	handler "{{.SDK}}"
+
+	"{{.Module}}/function"
+)
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	var input []byte
+	if r.Body != nil {
+		defer r.Body.Close()
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			log.Printf("Error reading body from request: %s", err)
+		}
+		input = body
+	}
+
+	req := handler.Request{
+		Body:        input,
+		Header:      r.Header,
+		Method:      r.Method,
+		QueryString: r.URL.RawQuery,
+		Host:        r.Host,
+	}
+	req.WithContext(r.Context())
+
+	result, err := function.Handle(req)
+
+	for key, values := range result.Header {
+		w.Header()[key] = values
+	}
+
+	switch {
+	case err != nil:
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+	case result.StatusCode == 0:
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(result.StatusCode)
+	}
+
+	_, _ = w.Write(result.Body)
+}
+
+func main() {
+	http.HandleFunc("/", handle)
+
+	log.Fatal(http.ListenAndServe("127.0.0.1:{{.Port}}", nil))
+}
+`
+
+// goHTTPSDK provides the handler.Request and handler.Response types of the 'golang-http' template's SDK.
+const goHTTPSDK = `// {{.Header}}
+
+package handler
+
+import (
+	"context"
+	"net/http"
+)
+
+// Response of function call
+type Response struct {
+	// Body the body will be written back
+	Body []byte
+
+	// StatusCode needs to be populated with value such as http.StatusOK
+	StatusCode int
+
+	// Header is optional and contains any additional headers the function response should set
+	Header http.Header
+}
+
+// Request of function call
+type Request struct {
+	Body        []byte
+	Header      http.Header
+	QueryString string
+	Method      string
+	Host        string
+	ctx         context.Context
+}
+
+// Context is set by the HTTP server and cancelled when the request completes, or the client disconnects
+func (r Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// WithContext overrides the context for the Request struct
+func (r *Request) WithContext(ctx context.Context) {
+	r.ctx = ctx
+}
+
+// FunctionHandler used for a serverless Go method invocation
+type FunctionHandler interface {
+	Handle(req Request) (Response, error)
+}
+`
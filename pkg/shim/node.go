@@ -0,0 +1,139 @@
+package shim
+
+// nodeServer is the of-watchdog Node.js HTTP harness, mapping each request to the handler through invoke, which is
+// specific to the handler's signature.
+const nodeServer = `// {{.Header}}
+
+'use strict'
+
+const http = require('http')
+const url = require('url')
+
+const handler = require({{printf "%q" .Handler}})
+
+class FunctionEvent {
+  constructor (req, body) {
+    const parsed = url.parse(req.url, true)
+    this.body = body
+    this.headers = req.headers
+    this.method = req.method
+    this.query = parsed.query
+    this.path = parsed.pathname
+  }
+}
+
+class FunctionContext {
+  constructor (cb) {
+    this.statusCode = 200
+    this.headerValues = {}
+    this.cb = cb
+  }
+
+  status (statusCode) {
+    if (!statusCode) {
+      return this.statusCode
+    }
+    this.statusCode = statusCode
+    return this
+  }
+
+  headers (value) {
+    if (!value) {
+      return this.headerValues
+    }
+    this.headerValues = value
+    return this
+  }
+
+  succeed (value) {
+    this.cb(undefined, value)
+  }
+
+  fail (value) {
+    this.cb(value)
+  }
+}
+
+const parseBody = (req, raw) => {
+  if ((req.headers['content-type'] || '').includes('application/json') && raw.length > 0) {
+    try {
+      return JSON.parse(raw)
+    } catch (err) {
+      return raw
+    }
+  }
+  return raw
+}
+
+const send = (res, statusCode, headers, value) => {
+  let body = value
+  if (body !== undefined && typeof body !== 'string' && !Buffer.isBuffer(body)) {
+    body = JSON.stringify(body)
+    headers = Object.assign({ 'Content-Type': 'application/json' }, headers)
+  }
+  res.writeHead(statusCode, headers)
+  res.end(body === undefined ? '' : body)
+}
+
+const fail = (res, err) => {
+  console.error(err)
+  send(res, 500, {}, String(err))
+}
+{{template "invoke" .}}
+http.createServer((req, res) => {
+  const chunks = []
+  req.on('data', chunk => chunks.push(chunk))
+  req.on('end', () => invoke(req, Buffer.concat(chunks).toString(), res))
+}).listen({{.Port}}, '127.0.0.1', () => {
+  console.log('OpenFaaS Node.js listening on port: {{.Port}}')
+})
+`
+
+// nodeEventMain serves handlers with the 'node12' template's '(event, context)' signature, which either call
+// context.succeed/fail or return (a promise of) the response.
+const nodeEventMain = nodeServer + `{{define "invoke"}}
+const invoke = (req, raw, res) => {
+  let responded = false
+  const fnContext = new FunctionContext((err, value) => {
+    if (responded) {
+      return
+    }
+    responded = true
+
+    if (err) {
+      return fail(res, err)
+    }
+    send(res, fnContext.status(), fnContext.headers(), value)
+  })
+
+  Promise.resolve()
+    .then(() => handler(new FunctionEvent(req, parseBody(req, raw)), fnContext))
+    .then(value => fnContext.succeed(value))
+    .catch(err => fnContext.fail(err))
+}
+{{end}}`
+
+// nodeCallbackMain serves handlers with the classic 'node' template's '(context, callback)' signature, where context
+// is the request body.
+const nodeCallbackMain = nodeServer + `{{define "invoke"}}
+const invoke = (req, raw, res) => {
+  let responded = false
+  const callback = (err, value) => {
+    if (responded) {
+      return
+    }
+    responded = true
+
+    if (err) {
+      return fail(res, err)
+    }
+    send(res, 200, {}, value)
+  }
+
+  try {
+    handler(raw, callback)
+  } catch (err) {
+    callback(err)
+  }
+}
+{{end}}`
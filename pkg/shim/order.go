@@ -0,0 +1,91 @@
+package shim
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+type groupTOML struct {
+	Group []struct {
+		ID string `toml:"id"`
+	} `toml:"group"`
+}
+
+type planTOML struct {
+	Entries []struct {
+		Providers []struct {
+			ID string `toml:"id"`
+		} `toml:"providers"`
+		Requires []struct {
+			Name string `toml:"name"`
+		} `toml:"requires"`
+	} `toml:"entries"`
+}
+
+// OrderWarning returns why a shim built by the language buildpack may never be built, when the group.toml and plan.toml
+// written by the lifecycle into layersDir show that no buildpack providing its language follows buildpackID. It returns
+// "" when the shim isn't built or the order can't be told.
+func OrderWarning(layersDir string, buildpackID string, s Shim) (string, error) {
+	if !s.Build {
+		return "", nil
+	}
+
+	group := groupTOML{}
+	if _, err := toml.DecodeFile(filepath.Join(layersDir, "group.toml"), &group); os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("reading group: %s", err)
+	}
+
+	plan := planTOML{}
+	if _, err := toml.DecodeFile(filepath.Join(layersDir, "plan.toml"), &plan); os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("reading plan: %s", err)
+	}
+
+	position := map[string]int{}
+	for i, buildpack := range group.Group {
+		position[buildpack.ID] = i
+	}
+
+	own, ok := position[buildpackID]
+	if !ok {
+		return "", nil
+	}
+
+	var providers []string
+	for _, entry := range plan.Entries {
+		required := false
+		for _, require := range entry.Requires {
+			required = required || require.Name == s.Template.Language
+		}
+		if !required {
+			continue
+		}
+
+		for _, provider := range entry.Providers {
+			if position[provider.ID] > own {
+				return "", nil
+			}
+			providers = append(providers, provider.ID)
+		}
+	}
+
+	if len(providers) == 0 {
+		return fmt.Sprintf(
+			"no buildpack provides '%s', so the generated '%s' entrypoint won't be built",
+			s.Template.Language, s.Template.Name,
+		), nil
+	}
+
+	return fmt.Sprintf(
+		"the buildpacks providing '%s' ([%s]) precede this one, so the generated '%s' entrypoint may not be built: "+
+			"order this buildpack before them",
+		s.Template.Language, strings.Join(providers, ", "), s.Template.Name,
+	), nil
+}
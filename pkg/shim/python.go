@@ -0,0 +1,105 @@
+package shim
+
+// pythonImport imports the handler module from the application, so that the handler's own imports resolve too.
+const pythonImport = `# {{.Header}}
+
+import os
+import sys
+
+sys.path.insert(0, os.path.dirname({{printf "%q" .Handler}}))
+
+from handler import handle  # noqa: E402
+`
+
+// pythonStdinMain serves handlers with the 'python3' template's 'handle(req)' signature, passing the request body on
+// stdin and writing the result to stdout.
+const pythonStdinMain = pythonImport + `
+
+def get_stdin():
+    buf = ""
+    while True:
+        line = sys.stdin.readline()
+        buf += line
+        if line == "":
+            break
+    return buf
+
+
+if __name__ == "__main__":
+    ret = handle(get_stdin())
+    if ret is not None:
+        print(ret)
+`
+
+// pythonHTTPMain serves handlers with the 'python3-http' template's 'handle(event, context)' signature, which return
+// either the body or a dict of 'statusCode', 'body' and 'headers'.
+const pythonHTTPMain = pythonImport + `
+import json  # noqa: E402
+import socket  # noqa: E402
+from http.server import BaseHTTPRequestHandler, HTTPServer  # noqa: E402
+from urllib.parse import parse_qs, urlparse  # noqa: E402
+
+
+class Event:
+    def __init__(self, request, body):
+        parsed = urlparse(request.path)
+        self.body = body
+        self.headers = request.headers
+        self.method = request.command
+        self.query = {key: values[-1] for key, values in parse_qs(parsed.query).items()}
+        self.path = parsed.path
+
+
+class Context:
+    def __init__(self):
+        self.hostname = socket.gethostname()
+
+
+def format_response(res):
+    if res is None:
+        return 200, {}, b""
+
+    status, headers, body = 200, {}, res
+    if isinstance(res, dict) and ("statusCode" in res or "body" in res or "headers" in res):
+        status = res.get("statusCode", 200)
+        headers = res.get("headers") or {}
+        body = res.get("body", "")
+
+    if isinstance(body, (dict, list)):
+        body = json.dumps(body)
+        headers = dict({"Content-Type": "application/json"}, **headers)
+    if body is None:
+        body = b""
+    if not isinstance(body, bytes):
+        body = str(body).encode()
+
+    return status, headers, body
+
+
+class Handler(BaseHTTPRequestHandler):
+    def invoke(self):
+        length = int(self.headers.get("Content-Length") or 0)
+        body = self.rfile.read(length) if length > 0 else b""
+
+        try:
+            status, headers, body = format_response(handle(Event(self, body), Context()))
+        except Exception as err:
+            sys.stderr.write("{}\n".format(err))
+            status, headers, body = 500, {}, str(err).encode()
+
+        self.send_response(status)
+        for name, value in headers.items():
+            self.send_header(name, value)
+        self.send_header("Content-Length", str(len(body)))
+        self.end_headers()
+        self.wfile.write(body)
+
+    do_GET = do_POST = do_PUT = do_PATCH = do_DELETE = do_OPTIONS = invoke
+
+
+if __name__ == "__main__":
+    server = HTTPServer(("127.0.0.1", {{.Port}}), Handler)
+    print("OpenFaaS Python listening on port: {{.Port}}")
+    sys.stdout.flush()
+    server.serve_forever()
+`
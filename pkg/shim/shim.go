@@ -0,0 +1,285 @@
+package shim
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	gotemplate "text/template"
+
+	"github.com/buildpacks/libbuildpack/v2/layers"
+	"github.com/buildpacks/libbuildpack/v2/logger"
+
+	"github.com/jromero/openfaas-cnb/pkg/launch"
+	"github.com/jromero/openfaas-cnb/pkg/template"
+)
+
+const (
+	layerName   = "shim"
+	processType = "function"
+	// goProcessType is the process type the Go buildpack launches the binary it builds as.
+	goProcessType   = "web"
+	generatedHeader = "Code generated by openfaas-cnb. DO NOT EDIT."
+	defaultModule   = "handler"
+	defaultGoSDK    = "github.com/openfaas/templates-sdk/go-http"
+	upstreamPort    = 8082
+)
+
+var (
+	mainPackagePattern = regexp.MustCompile(`(?m)^package\s+main\b`)
+	modulePattern      = regexp.MustCompile(`(?m)^module\s+"?([^"\s]+)"?`)
+	goSDKImportPattern = regexp.MustCompile(`"(github\.com/openfaas(?:-incubator)?/(?:templates-sdk/go-http|go-function-sdk))"`)
+	goSDKDir           = filepath.Join(".openfaas", "sdk")
+)
+
+// Shim is a generated entrypoint wrapping a function's handler, in place of the one the OpenFaaS template provides.
+type Shim struct {
+	// Template is the template the shim was generated for.
+	Template template.Template
+	// Files are the contents of the generated files, keyed by their path relative to the shim layer, or to the
+	// application when built.
+	Files map[string]string
+	// Build indicates the files are built by the language buildpack, so are written into the application instead.
+	Build bool
+	// Mode is the watchdog mode the shim is served with.
+	Mode string
+	// Env are the watchdog env vars the shim requires, e.g. upstream_url.
+	Env map[string]string
+	// ProcessType is the process type the shim runs as: the one launching it from the shim layer, or the one the
+	// language buildpack launches it as once built.
+	ProcessType string
+	// Interpreter is the command running Entrypoint, the shim's file launched from the shim layer.
+	Interpreter string
+	Entrypoint  string
+}
+
+// Launched reports whether the shim is launched from the shim layer, rather than built by the language buildpack.
+func (s Shim) Launched() bool {
+	return s.Entrypoint != ""
+}
+
+// Process returns the process launching the shim from shimLayer.
+func (s Shim) Process(shimLayer layers.Layer) layers.Process {
+	return layers.Process{
+		Type:    s.ProcessType,
+		Command: fmt.Sprintf("%s %s", s.Interpreter, filepath.Join(shimLayer.Root, s.Entrypoint)),
+		Args:    nil,
+		Direct:  false,
+	}
+}
+
+type shimData struct {
+	Header  string
+	Module  string
+	SDK     string
+	Handler string
+	Port    int
+}
+
+// Generate generates the shim for tmpl, returning false when the application provides its own entrypoint or the
+// template requires no shim.
+func Generate(appDir string, tmpl template.Template) (Shim, bool, error) {
+	switch tmpl.Name {
+	case "go":
+		return generateGo(appDir, tmpl, goStdinMain, "streaming", nil, false)
+	case "golang-middleware":
+		return generateGo(appDir, tmpl, goMiddlewareMain, "http", upstreamEnv(), false)
+	case "golang-http":
+		return generateGo(appDir, tmpl, goHTTPMain, "http", upstreamEnv(), true)
+	case "node12":
+		return generateLaunched(appDir, tmpl, nodeEventMain, "http", upstreamEnv(), "node", "index.js")
+	case "node":
+		return generateLaunched(appDir, tmpl, nodeCallbackMain, "http", upstreamEnv(), "node", "index.js")
+	case "python3-http":
+		return generateLaunched(appDir, tmpl, pythonHTTPMain, "http", upstreamEnv(), "python3", "index.py")
+	case "python3":
+		return generateLaunched(appDir, tmpl, pythonStdinMain, "streaming", nil, "python3", "index.py")
+	default:
+		return Shim{}, false, nil
+	}
+}
+
+func generateGo(appDir string, tmpl template.Template, source string, mode string, env map[string]string, withSDK bool) (Shim, bool, error) {
+	hasMain, err := hasGoMain(appDir)
+	if err != nil || hasMain {
+		return Shim{}, false, err
+	}
+
+	files := map[string]string{}
+
+	goMod, err := ioutil.ReadFile(filepath.Join(appDir, "go.mod"))
+	if os.IsNotExist(err) {
+		goMod = []byte(fmt.Sprintf("module %s\n\ngo 1.13\n", defaultModule))
+		files["go.mod"] = string(goMod)
+	} else if err != nil {
+		return Shim{}, false, err
+	}
+
+	data := shimData{Header: generatedHeader, Module: defaultModule, Port: upstreamPort}
+	if match := modulePattern.FindSubmatch(goMod); match != nil {
+		data.Module = string(match[1])
+	}
+
+	if withSDK {
+		data.SDK, err = goSDKImportPath(appDir, tmpl)
+		if err != nil {
+			return Shim{}, false, err
+		}
+
+		// the SDK is only generated when the application doesn't already depend on it
+		if !strings.Contains(string(goMod), data.SDK) {
+			sdk, err := render(goHTTPSDK, data)
+			if err != nil {
+				return Shim{}, false, err
+			}
+
+			files[filepath.Join(goSDKDir, "go.mod")] = fmt.Sprintf("module %s\n\ngo 1.13\n", data.SDK)
+			files[filepath.Join(goSDKDir, "handler.go")] = sdk
+			files["go.mod"] = string(goMod) + fmt.Sprintf(
+				"\nrequire %s v0.0.0\n\nreplace %s => ./%s\n", data.SDK, data.SDK, filepath.ToSlash(goSDKDir),
+			)
+		}
+	}
+
+	main, err := render(source, data)
+	if err != nil {
+		return Shim{}, false, err
+	}
+	files["main.go"] = main
+
+	return Shim{
+		Template:    tmpl,
+		Files:       files,
+		Build:       true,
+		Mode:        mode,
+		Env:         env,
+		ProcessType: goProcessType,
+	}, true, nil
+}
+
+// goSDKImportPath returns the path the handler imports the SDK's handler.Request and handler.Response types from.
+func goSDKImportPath(appDir string, tmpl template.Template) (string, error) {
+	handler, err := ioutil.ReadFile(filepath.Join(appDir, tmpl.Handler))
+	if err != nil {
+		return "", err
+	}
+
+	if match := goSDKImportPattern.FindSubmatch(handler); match != nil {
+		return string(match[1]), nil
+	}
+
+	return defaultGoSDK, nil
+}
+
+// generateLaunched generates a shim for an interpreted handler, launched by interpreter from the shim layer.
+func generateLaunched(
+	appDir string, tmpl template.Template, source string, mode string, env map[string]string, interpreter string,
+	entrypoint string,
+) (Shim, bool, error) {
+	main, err := render(source, shimData{
+		Header:  generatedHeader,
+		Handler: filepath.Join(appDir, tmpl.Handler),
+		Port:    upstreamPort,
+	})
+	if err != nil {
+		return Shim{}, false, err
+	}
+
+	return Shim{
+		Template:    tmpl,
+		Files:       map[string]string{entrypoint: main},
+		Mode:        mode,
+		Env:         env,
+		ProcessType: processType,
+		Interpreter: interpreter,
+		Entrypoint:  entrypoint,
+	}, true, nil
+}
+
+func upstreamEnv() map[string]string {
+	return map[string]string{
+		"upstream_url": fmt.Sprintf("http://127.0.0.1:%d", upstreamPort),
+	}
+}
+
+// hasGoMain reports whether appDir contains a main package, ignoring previously generated shims.
+func hasGoMain(appDir string) (bool, error) {
+	sources, err := filepath.Glob(filepath.Join(appDir, "*.go"))
+	if err != nil {
+		return false, err
+	}
+
+	for _, source := range sources {
+		contents, err := ioutil.ReadFile(source)
+		if err != nil {
+			return false, err
+		}
+
+		if mainPackagePattern.Match(contents) && !strings.Contains(string(contents), generatedHeader) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func render(source string, data shimData) (string, error) {
+	t, err := gotemplate.New("shim").Parse(source)
+	if err != nil {
+		return "", err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// Contribute writes the shim's files into appDir when they are built by the language buildpack, otherwise into the shim
+// layer they are launched from. The shim layer is removed when the shim is built.
+func Contribute(log logger.Logger, lyrs layers.Layers, api launch.API, appDir string, shim Shim) (layers.Layer, error) {
+	shimLayer := lyrs.Layer(layerName)
+	if err := os.RemoveAll(shimLayer.Root); err != nil {
+		return shimLayer, errors.New("removing previous shim: " + err.Error())
+	}
+
+	dir := shimLayer.Root
+	if shim.Build {
+		dir = appDir
+	}
+
+	for path, contents := range shim.Files {
+		log.Debug("generating %s shim: %s", shim.Template.Name, path)
+		if err := writeFile(filepath.Join(dir, path), contents); err != nil {
+			return shimLayer, errors.New("writing shim: " + err.Error())
+		}
+	}
+
+	if shim.Build {
+		if err := shimLayer.RemoveMetadata(); err != nil {
+			return shimLayer, errors.New("removing previous shim: " + err.Error())
+		}
+		return shimLayer, nil
+	}
+
+	metadata := map[string]string{"template": shim.Template.Name}
+	if err := launch.WriteLayerMetadata(shimLayer, api, metadata, layers.Launch); err != nil {
+		return shimLayer, errors.New("writing metadata: " + err.Error())
+	}
+
+	return shimLayer, nil
+}
+
+func writeFile(path string, contents string) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, []byte(contents), 0644)
+}
@@ -0,0 +1,320 @@
+package shim_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buildpacks/libbuildpack/v2/layers"
+	"github.com/buildpacks/libbuildpack/v2/logger"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/jromero/openfaas-cnb/pkg/launch"
+	"github.com/jromero/openfaas-cnb/pkg/shim"
+	"github.com/jromero/openfaas-cnb/pkg/template"
+)
+
+func TestShim(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Shim")
+}
+
+var _ = Describe("Shim", func() {
+	var (
+		tmpDir string
+		appDir string
+		api    = launch.API{Major: 0, Minor: 6}
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "")
+		Expect(err).To(BeNil())
+
+		appDir = filepath.Join(tmpDir, "app")
+		Expect(os.MkdirAll(appDir, os.ModePerm)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(BeNil())
+	})
+
+	writeFile := func(name, contents string) {
+		Expect(os.MkdirAll(filepath.Dir(filepath.Join(appDir, name)), os.ModePerm)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(appDir, name), []byte(contents), 0644)).To(Succeed())
+	}
+
+	generate := func(name string) (shim.Shim, bool) {
+		tmpl, err := template.Lookup(name)
+		Expect(err).To(BeNil())
+
+		s, generated, err := shim.Generate(appDir, tmpl)
+		Expect(err).To(BeNil())
+		return s, generated
+	}
+
+	Describe("Generate", func() {
+		Context("go template", func() {
+			BeforeEach(func() {
+				writeFile(filepath.Join("function", "handler.go"), "package function\n")
+			})
+
+			It("generates a stdin wrapper and go.mod", func() {
+				s, generated := generate("go")
+				Expect(generated).To(BeTrue())
+				Expect(s.Mode).To(Equal("streaming"))
+				Expect(s.Build).To(BeTrue())
+				Expect(s.Launched()).To(BeFalse())
+				Expect(s.ProcessType).To(Equal("web"))
+				Expect(s.Files).To(HaveKey("go.mod"))
+				Expect(s.Files["main.go"]).To(ContainSubstring(`"handler/function"`))
+				Expect(s.Files["main.go"]).To(ContainSubstring("function.Handle(input)"))
+			})
+
+			It("imports the function from the application's module", func() {
+				writeFile("go.mod", "module github.com/example/fn\n\ngo 1.13\n")
+
+				s, generated := generate("go")
+				Expect(generated).To(BeTrue())
+				Expect(s.Files).ToNot(HaveKey("go.mod"))
+				Expect(s.Files["main.go"]).To(ContainSubstring(`"github.com/example/fn/function"`))
+			})
+
+			It("isn't generated when the application has a main package", func() {
+				writeFile("main.go", "package main\n\nfunc main() {}\n")
+
+				_, generated := generate("go")
+				Expect(generated).To(BeFalse())
+			})
+		})
+
+		Context("golang-middleware template", func() {
+			It("generates an http wrapper", func() {
+				writeFile(filepath.Join("function", "handler.go"), "package function\n")
+
+				s, generated := generate("golang-middleware")
+				Expect(generated).To(BeTrue())
+				Expect(s.Mode).To(Equal("http"))
+				Expect(s.Env).To(Equal(map[string]string{"upstream_url": "http://127.0.0.1:8082"}))
+				Expect(s.Files["main.go"]).To(ContainSubstring(`http.HandleFunc("/", function.Handle)`))
+			})
+		})
+		Context("golang-http template", func() {
+			It("generates the http harness and the SDK", func() {
+				writeFile(filepath.Join("function", "handler.go"), `package function
+
+import handler "github.com/openfaas-incubator/go-function-sdk"
+`)
+
+				s, generated := generate("golang-http")
+				Expect(generated).To(BeTrue())
+				Expect(s.Mode).To(Equal("http"))
+				Expect(s.Env).To(Equal(map[string]string{"upstream_url": "http://127.0.0.1:8082"}))
+				Expect(s.Files["main.go"]).To(ContainSubstring(`handler "github.com/openfaas-incubator/go-function-sdk"`))
+				Expect(s.Files[filepath.Join(".openfaas", "sdk", "handler.go")]).To(ContainSubstring("type Request struct"))
+				Expect(s.Files[filepath.Join(".openfaas", "sdk", "go.mod")]).To(HavePrefix("module github.com/openfaas-incubator/go-function-sdk\n"))
+				Expect(s.Files["go.mod"]).To(Equal(`module handler
+
+go 1.13
+
+require github.com/openfaas-incubator/go-function-sdk v0.0.0
+
+replace github.com/openfaas-incubator/go-function-sdk => ./.openfaas/sdk
+`))
+			})
+
+			It("doesn't generate the SDK when the application depends on it", func() {
+				writeFile(filepath.Join("function", "handler.go"), "package function\n")
+				writeFile("go.mod", `module handler
+
+require github.com/openfaas/templates-sdk/go-http v0.0.1
+`)
+
+				s, generated := generate("golang-http")
+				Expect(generated).To(BeTrue())
+				Expect(s.Files).To(HaveLen(1))
+				Expect(s.Files["main.go"]).To(ContainSubstring(`handler "github.com/openfaas/templates-sdk/go-http"`))
+			})
+		})
+		Context("node templates", func() {
+			generateFixture := func(fixture string) shim.Shim {
+				fixtureDir, err := filepath.Abs(filepath.Join("testdata", fixture))
+				Expect(err).To(BeNil())
+
+				tmpl, found, err := template.Detect(fixtureDir)
+				Expect(err).To(BeNil())
+				Expect(found).To(BeTrue())
+				Expect(tmpl.Name).To(Equal(fixture))
+
+				s, generated, err := shim.Generate(fixtureDir, tmpl)
+				Expect(err).To(BeNil())
+				Expect(generated).To(BeTrue())
+				Expect(s.Mode).To(Equal("http"))
+				Expect(s.Env).To(Equal(map[string]string{"upstream_url": "http://127.0.0.1:8082"}))
+				Expect(s.ProcessType).To(Equal("function"))
+				Expect(s.Files["index.js"]).To(ContainSubstring(`require("` + filepath.Join(fixtureDir, "handler.js") + `")`))
+				return s
+			}
+
+			It("generates an http harness for '(event, context)' handlers", func() {
+				s := generateFixture("node12")
+				Expect(s.Files["index.js"]).To(ContainSubstring("handler(new FunctionEvent(req, parseBody(req, raw)), fnContext)"))
+			})
+
+			It("generates an http harness for '(context, callback)' handlers", func() {
+				s := generateFixture("node")
+				Expect(s.Files["index.js"]).To(ContainSubstring("handler(raw, callback)"))
+			})
+
+			It("is launched from the shim layer", func() {
+				s := generateFixture("node12")
+
+				lyrs := layers.NewLayers(filepath.Join(tmpDir, "layers"), logger.Logger{})
+				shimLayer, err := shim.Contribute(logger.Logger{}, lyrs, api, appDir, s)
+				Expect(err).To(BeNil())
+
+				Expect(filepath.Join(shimLayer.Root, "index.js")).To(BeARegularFile())
+				Expect(filepath.Join(appDir, "index.js")).ToNot(BeAnExistingFile())
+				Expect(s.Process(shimLayer)).To(Equal(layers.Process{
+					Type:    "function",
+					Command: "node " + filepath.Join(shimLayer.Root, "index.js"),
+				}))
+			})
+		})
+
+		Context("python templates", func() {
+			generateFixture := func(fixture string) (shim.Shim, string) {
+				fixtureDir, err := filepath.Abs(filepath.Join("testdata", fixture))
+				Expect(err).To(BeNil())
+
+				tmpl, found, err := template.Detect(fixtureDir)
+				Expect(err).To(BeNil())
+				Expect(found).To(BeTrue())
+				Expect(tmpl.Name).To(Equal(fixture))
+
+				s, generated, err := shim.Generate(fixtureDir, tmpl)
+				Expect(err).To(BeNil())
+				Expect(generated).To(BeTrue())
+				Expect(s.ProcessType).To(Equal("function"))
+				Expect(s.Files["index.py"]).To(ContainSubstring(`sys.path.insert(0, os.path.dirname("` + filepath.Join(fixtureDir, "handler.py") + `"))`))
+				return s, fixtureDir
+			}
+
+			It("generates a stdin wrapper for 'handle(req)' handlers", func() {
+				s, _ := generateFixture("python3")
+				Expect(s.Mode).To(Equal("streaming"))
+				Expect(s.Env).To(BeEmpty())
+				Expect(s.Files["index.py"]).To(ContainSubstring("ret = handle(get_stdin())"))
+			})
+
+			It("generates an http server wrapper for 'handle(event, context)' handlers", func() {
+				s, _ := generateFixture("python3-http")
+				Expect(s.Mode).To(Equal("http"))
+				Expect(s.Env).To(Equal(map[string]string{"upstream_url": "http://127.0.0.1:8082"}))
+				Expect(s.Files["index.py"]).To(ContainSubstring(`HTTPServer(("127.0.0.1", 8082), Handler)`))
+			})
+
+			It("is launched by python3 from the shim layer", func() {
+				s, _ := generateFixture("python3-http")
+
+				lyrs := layers.NewLayers(filepath.Join(tmpDir, "layers"), logger.Logger{})
+				shimLayer, err := shim.Contribute(logger.Logger{}, lyrs, api, appDir, s)
+				Expect(err).To(BeNil())
+
+				Expect(s.Process(shimLayer)).To(Equal(layers.Process{
+					Type:    "function",
+					Command: "python3 " + filepath.Join(shimLayer.Root, "index.py"),
+				}))
+			})
+		})
+	})
+
+	Describe("Contribute", func() {
+		It("writes a built shim into the application only", func() {
+			writeFile(filepath.Join("function", "handler.go"), "package function\n")
+			s, _ := generate("go")
+
+			lyrs := layers.NewLayers(filepath.Join(tmpDir, "layers"), logger.Logger{})
+			Expect(os.MkdirAll(lyrs.Layer("shim").Root, os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(lyrs.Layer("shim").Metadata, []byte("build = true\n"), 0644)).To(Succeed())
+
+			shimLayer, err := shim.Contribute(logger.Logger{}, lyrs, api, appDir, s)
+			Expect(err).To(BeNil())
+
+			Expect(shimLayer.Root).ToNot(BeADirectory())
+			Expect(shimLayer.Metadata).ToNot(BeAnExistingFile())
+			Expect(filepath.Join(appDir, "main.go")).To(BeARegularFile())
+			Expect(filepath.Join(appDir, "go.mod")).To(BeARegularFile())
+
+			By("regenerating on the next build", func() {
+				_, generated := generate("go")
+				Expect(generated).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("OrderWarning", func() {
+		var (
+			layersDir string
+			s         shim.Shim
+		)
+
+		BeforeEach(func() {
+			layersDir = filepath.Join(tmpDir, "layers")
+			Expect(os.MkdirAll(layersDir, os.ModePerm)).To(Succeed())
+
+			writeFile(filepath.Join("function", "handler.go"), "package function\n")
+			s, _ = generate("go")
+		})
+
+		writeLifecycleFiles := func(group ...string) {
+			groupTOML := ""
+			for _, id := range group {
+				groupTOML += fmt.Sprintf("[[group]]\nid = %q\nversion = \"1.0.0\"\n\n", id)
+			}
+			Expect(ioutil.WriteFile(filepath.Join(layersDir, "group.toml"), []byte(groupTOML), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(layersDir, "plan.toml"), []byte(`
+[[entries]]
+  [[entries.providers]]
+    id = "heroku/go"
+  [[entries.requires]]
+    name = "go"
+`), 0644)).To(Succeed())
+		}
+
+		It("doesn't warn when the Go buildpack follows this one", func() {
+			writeLifecycleFiles("codes.jromero.openfaas", "heroku/go")
+
+			warning, err := shim.OrderWarning(layersDir, "codes.jromero.openfaas", s)
+			Expect(err).To(BeNil())
+			Expect(warning).To(BeEmpty())
+		})
+
+		It("warns when the Go buildpack precedes this one", func() {
+			writeLifecycleFiles("heroku/go", "codes.jromero.openfaas")
+
+			warning, err := shim.OrderWarning(layersDir, "codes.jromero.openfaas", s)
+			Expect(err).To(BeNil())
+			Expect(warning).To(Equal("the buildpacks providing 'go' ([heroku/go]) precede this one, so the generated 'go' " +
+				"entrypoint may not be built: order this buildpack before them"))
+		})
+
+		It("warns when no buildpack provides go", func() {
+			writeLifecycleFiles("codes.jromero.openfaas")
+			Expect(ioutil.WriteFile(filepath.Join(layersDir, "plan.toml"), []byte(""), 0644)).To(Succeed())
+
+			warning, err := shim.OrderWarning(layersDir, "codes.jromero.openfaas", s)
+			Expect(err).To(BeNil())
+			Expect(warning).To(Equal("no buildpack provides 'go', so the generated 'go' entrypoint won't be built"))
+		})
+
+		It("doesn't warn when the order is unknown", func() {
+			warning, err := shim.OrderWarning(layersDir, "codes.jromero.openfaas", s)
+			Expect(err).To(BeNil())
+			Expect(warning).To(BeEmpty())
+		})
+	})
+})
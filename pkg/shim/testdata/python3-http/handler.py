@@ -0,0 +1,5 @@
+def handle(event, context):
+    return {
+        "statusCode": 200,
+        "body": {"method": event.method, "body": event.body.decode()},
+    }
@@ -0,0 +1,130 @@
+package template
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// Template is an OpenFaaS template whose layout is recognised within an application.
+type Template struct {
+	// Name is the name of the OpenFaaS template, e.g. 'golang-http'.
+	Name string
+	// Language is the name of the build plan entry required for the template's language, e.g. 'go'.
+	Language string
+	// Handler is the path to the handler file, relative to the application.
+	Handler string
+	// Slices are the default launch slices of the application, each a set of globs relative to the application, so that
+	// the function's code is layered apart from its vendored dependencies.
+	Slices [][]string
+
+	// requires are the files, relative to the application, that must exist alongside the handler.
+	requires []string
+	// signature matches the contents of the handler, when templates share a handler file.
+	signature *regexp.Regexp
+}
+
+// templates are the recognised templates, in order of precedence.
+var templates = []Template{
+	{
+		Name:      "golang-http",
+		Language:  "go",
+		Handler:   filepath.Join("function", "handler.go"),
+		Slices:    [][]string{{"vendor/**"}, {"function/**"}},
+		signature: regexp.MustCompile(`func\s+Handle\s*\(\s*\w+\s+handler\.Request\s*\)`),
+	},
+	{
+		Name:      "golang-middleware",
+		Language:  "go",
+		Handler:   filepath.Join("function", "handler.go"),
+		Slices:    [][]string{{"vendor/**"}, {"function/**"}},
+		signature: regexp.MustCompile(`func\s+Handle\s*\(\s*\w+\s+http\.ResponseWriter\s*,\s*\w+\s+\*http\.Request\s*\)`),
+	},
+	{
+		Name:     "go",
+		Language: "go",
+		Handler:  filepath.Join("function", "handler.go"),
+		Slices:   [][]string{{"vendor/**"}, {"function/**"}},
+	},
+	{
+		Name:      "node12",
+		Language:  "node",
+		Handler:   "handler.js",
+		Slices:    [][]string{{"node_modules/**"}, {"handler.js"}},
+		requires:  []string{"package.json"},
+		signature: regexp.MustCompile(`\(\s*event\s*,\s*context\s*\)`),
+	},
+	{
+		Name:     "node",
+		Language: "node",
+		Handler:  "handler.js",
+		Slices:   [][]string{{"node_modules/**"}, {"handler.js"}},
+		requires: []string{"package.json"},
+	},
+	{
+		Name:      "python3-http",
+		Language:  "python",
+		Handler:   "handler.py",
+		Slices:    [][]string{{"handler.py"}},
+		requires:  []string{"requirements.txt"},
+		signature: regexp.MustCompile(`def\s+handle\s*\(\s*event\s*,\s*context\s*\)`),
+	},
+	{
+		Name:     "python3",
+		Language: "python",
+		Handler:  "handler.py",
+		Slices:   [][]string{{"handler.py"}},
+		requires: []string{"requirements.txt"},
+	},
+}
+
+// Detect returns the first template whose layout is recognised within appDir.
+func Detect(appDir string) (Template, bool, error) {
+	for _, template := range templates {
+		matches, err := template.matches(appDir)
+		if err != nil {
+			return Template{}, false, err
+		}
+
+		if matches {
+			return template, true, nil
+		}
+	}
+
+	return Template{}, false, nil
+}
+
+// Lookup returns the template with the given name.
+func Lookup(name string) (Template, error) {
+	for _, template := range templates {
+		if template.Name == name {
+			return template, nil
+		}
+	}
+
+	return Template{}, fmt.Errorf("unknown template '%s'", name)
+}
+
+func (t Template) matches(appDir string) (bool, error) {
+	for _, path := range append([]string{t.Handler}, t.requires...) {
+		if _, err := os.Stat(filepath.Join(appDir, path)); err != nil {
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+
+	if t.signature == nil {
+		return true, nil
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(appDir, t.Handler))
+	if err != nil {
+		return false, err
+	}
+
+	return t.signature.Match(contents), nil
+}
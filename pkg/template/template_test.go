@@ -0,0 +1,143 @@
+package template_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/jromero/openfaas-cnb/pkg/template"
+)
+
+func TestTemplate(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Template")
+}
+
+var _ = Describe("Template", func() {
+	var appDir string
+
+	BeforeEach(func() {
+		var err error
+		appDir, err = ioutil.TempDir("", "app")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(appDir)).To(BeNil())
+	})
+
+	writeFile := func(name, contents string) {
+		Expect(os.MkdirAll(filepath.Dir(filepath.Join(appDir, name)), os.ModePerm)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(appDir, name), []byte(contents), 0644)).To(Succeed())
+	}
+
+	detect := func() (template.Template, bool) {
+		tmpl, found, err := template.Detect(appDir)
+		Expect(err).To(BeNil())
+		return tmpl, found
+	}
+
+	Describe("Detect", func() {
+		It("recognises the go template", func() {
+			writeFile(filepath.Join("function", "handler.go"), `package function
+
+func Handle(req []byte) string {
+	return string(req)
+}
+`)
+
+			tmpl, found := detect()
+			Expect(found).To(BeTrue())
+			Expect(tmpl.Name).To(Equal("go"))
+			Expect(tmpl.Language).To(Equal("go"))
+		})
+
+		It("recognises the golang-http template", func() {
+			writeFile(filepath.Join("function", "handler.go"), `package function
+
+import handler "github.com/openfaas/templates-sdk/go-http"
+
+func Handle(req handler.Request) (handler.Response, error) {
+	return handler.Response{Body: req.Body}, nil
+}
+`)
+
+			tmpl, found := detect()
+			Expect(found).To(BeTrue())
+			Expect(tmpl.Name).To(Equal("golang-http"))
+		})
+
+		It("recognises the golang-middleware template", func() {
+			writeFile(filepath.Join("function", "handler.go"), `package function
+
+import "net/http"
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+}
+`)
+
+			tmpl, found := detect()
+			Expect(found).To(BeTrue())
+			Expect(tmpl.Name).To(Equal("golang-middleware"))
+		})
+
+		It("recognises the node template", func() {
+			writeFile("handler.js", `module.exports = (context, callback) => callback(undefined, context)`)
+			writeFile("package.json", `{}`)
+
+			tmpl, found := detect()
+			Expect(found).To(BeTrue())
+			Expect(tmpl.Name).To(Equal("node"))
+			Expect(tmpl.Language).To(Equal("node"))
+		})
+
+		It("recognises the node12 template", func() {
+			writeFile("handler.js", `module.exports = async (event, context) => context.status(200).succeed(event.body)`)
+			writeFile("package.json", `{}`)
+
+			tmpl, found := detect()
+			Expect(found).To(BeTrue())
+			Expect(tmpl.Name).To(Equal("node12"))
+			Expect(tmpl.Language).To(Equal("node"))
+		})
+
+		It("recognises the python3-http template", func() {
+			writeFile("handler.py", "def handle(event, context):\n    return event.body\n")
+			writeFile("requirements.txt", ``)
+
+			tmpl, found := detect()
+			Expect(found).To(BeTrue())
+			Expect(tmpl.Name).To(Equal("python3-http"))
+			Expect(tmpl.Language).To(Equal("python"))
+		})
+
+		It("recognises the python3 template", func() {
+			writeFile("handler.py", "def handle(req):\n    return req\n")
+			writeFile("requirements.txt", ``)
+
+			tmpl, found := detect()
+			Expect(found).To(BeTrue())
+			Expect(tmpl.Name).To(Equal("python3"))
+			Expect(tmpl.Language).To(Equal("python"))
+		})
+
+		It("requires the files alongside the handler", func() {
+			writeFile("handler.py", "def handle(req):\n    return req\n")
+
+			_, found := detect()
+			Expect(found).To(BeFalse())
+		})
+	})
+
+	Describe("Lookup", func() {
+		It("fails for an unknown template", func() {
+			_, err := template.Lookup("cobol")
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(Equal("unknown template 'cobol'"))
+		})
+	})
+})
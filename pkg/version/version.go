@@ -8,8 +8,8 @@ import (
 // GitCommit returns the git commit that was compiled. This will be filled in by the compiler.
 var GitCommit string
 
-// Version returns the main version number that is being run at the moment.
-const Version = ""
+// Version returns the main version number that is being run at the moment. This will be filled in by the compiler.
+var Version = ""
 
 // BuildDate returns the date the binary was built
 var BuildDate = ""
@@ -0,0 +1,68 @@
+package watchdog
+
+import (
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/buildpacks/libbuildpack/v2/layers"
+
+	"github.com/jromero/openfaas-cnb/pkg/launch"
+)
+
+const (
+	bomName    = "of-watchdog"
+	bomLicense = "MIT"
+)
+
+var elfArchs = map[elf.Machine]string{
+	elf.EM_386:     "386",
+	elf.EM_X86_64:  "amd64",
+	elf.EM_ARM:     "arm",
+	elf.EM_AARCH64: "arm64",
+	elf.EM_PPC64:   "ppc64le",
+	elf.EM_S390:    "s390x",
+}
+
+// downloadURL returns the URL of the watchdog release binary of version.
+func downloadURL(version string) string {
+	return fmt.Sprintf("https://github.com/openfaas-incubator/of-watchdog/releases/download/%s/of-watchdog", version)
+}
+
+// bomEntry describes the watchdog binary installed into watchdogLayer. The source of a binary copied from binary_path
+// is unknown, and so is the architecture of a binary that isn't an ELF executable.
+func bomEntry(watchdogLayer layers.Layer, conf Config) (launch.BOMEntry, error) {
+	binary := filepath.Join(watchdogLayer.Root, executableName)
+
+	fh, err := os.Open(binary)
+	if err != nil {
+		return launch.BOMEntry{}, err
+	}
+	defer fh.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, fh); err != nil {
+		return launch.BOMEntry{}, err
+	}
+
+	entry := launch.BOMEntry{
+		Name:    bomName,
+		Version: conf.Version,
+		SHA256:  hex.EncodeToString(hash.Sum(nil)),
+		License: bomLicense,
+	}
+
+	if conf.BinaryPath == "" {
+		entry.Source = downloadURL(conf.Version)
+	}
+
+	if exe, err := elf.NewFile(fh); err == nil {
+		entry.Arch = elfArchs[exe.Machine]
+	}
+
+	return entry, nil
+}
@@ -1,37 +1,134 @@
 package watchdog
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/BurntSushi/toml"
+
+	"github.com/jromero/openfaas-cnb/pkg/shim"
+	"github.com/jromero/openfaas-cnb/pkg/template"
 )
 
 const (
 	configName         = "watchdog.toml"
+	projectConfigName  = "project.toml"
 	defaultProcessType = "web"
 	defaultVersion     = "0.7.6"
+	// StaticMode is the mode serving the files of static_path, without an upstream process.
+	StaticMode = "static"
+)
+
+const (
+	// ConfigEnv is the platform environment variable pointing to a watchdog config file, relative to the application.
+	ConfigEnv = "BP_WATCHDOG_CONFIG"
+	// ProfileEnv is the platform environment variable selecting a [watchdog.profiles.<name>] table.
+	ProfileEnv = "BP_WATCHDOG_PROFILE"
+	// overrideEnvPrefix prefixes the platform environment variables overriding the values of envOverrides, e.g.
+	// BP_WATCHDOG_VERSION.
+	overrideEnvPrefix = "BP_WATCHDOG_"
+)
+
+// envOverrides are the keys that may be overridden with a BP_WATCHDOG_<KEY> platform environment variable.
+var envOverrides = []string{"version", "process_type"}
+
+const (
+	// OriginDefault is the origin of values defaulted by the buildpack.
+	OriginDefault = "default"
+	// OriginPlatformEnv is the origin of values overridden by a BP_WATCHDOG_<KEY> platform environment variable.
+	OriginPlatformEnv = "platform env"
 )
 
+// configSearchPaths are the locations, relative to the application, searched for a watchdog config file.
+var configSearchPaths = []string{
+	configName,
+	filepath.Join(".openfaas", configName),
+}
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// modes are the modes supported by the watchdog.
+var modes = []string{"streaming", "serializing", "http", StaticMode, "afterburn"}
+
+// ConfigKind is the kind of file a configuration is read from.
+type ConfigKind int
+
+const (
+	// WatchdogConfig is a watchdog.toml file with a [watchdog] table.
+	WatchdogConfig ConfigKind = iota
+	// ProjectConfig is a project descriptor (project.toml) with a [metadata.openfaas.watchdog] or
+	// [io.buildpacks.openfaas] table.
+	ProjectConfig
+	// StackConfig is an OpenFaaS stack.yml, whose function's labels and annotations are used.
+	StackConfig
+)
+
+// ConfigSource is a configuration file discovered within the application.
+type ConfigSource struct {
+	Path string
+	Kind ConfigKind
+}
+
+func (s ConfigSource) origin() string {
+	switch s.Kind {
+	case ProjectConfig:
+		return projectConfigName
+	case StackConfig:
+		return stackConfigName
+	default:
+		return configName
+	}
+}
+
 type configTOML struct {
 	Watchdog Config `toml:"watchdog"`
 }
 
-func ParseConfig(reader io.Reader) (Config, error) {
-	cTOML := &configTOML{}
-	if _, err := toml.DecodeReader(reader, &cTOML); err != nil {
-		return cTOML.Watchdog, err
-	}
+type projectTOML struct {
+	Metadata struct {
+		OpenFaaS struct {
+			Watchdog *Config `toml:"watchdog"`
+		} `toml:"openfaas"`
+	} `toml:"metadata"`
+	IO struct {
+		Buildpacks struct {
+			OpenFaaS *Config `toml:"openfaas"`
+		} `toml:"buildpacks"`
+	} `toml:"io"`
+}
+
+// ParseConfig parses a watchdog.toml file, interpolating variable references from env and applying defaults for any
+// unset values.
+func ParseConfig(reader io.Reader, env map[string]string) (Config, error) {
+	return parseConfig(reader, decodeConfig, env)
+}
 
-	if cTOML.Watchdog.Version == "" {
-		cTOML.Watchdog.Version = defaultVersion
+// ParseProjectConfig parses the watchdog configuration from a project descriptor (project.toml), interpolating
+// variable references from env and applying defaults for any unset values.
+func ParseProjectConfig(reader io.Reader, env map[string]string) (Config, error) {
+	return parseConfig(reader, decodeProjectConfig, env)
+}
+
+func parseConfig(reader io.Reader, decode func(io.Reader) (Config, error), env map[string]string) (Config, error) {
+	conf, err := decode(reader)
+	if err != nil {
+		return conf, err
 	}
 
-	if cTOML.Watchdog.ProcessType == "" {
-		cTOML.Watchdog.ProcessType = defaultProcessType
+	if err := interpolateConfig(&conf, env); err != nil {
+		return conf, err
 	}
 
-	return cTOML.Watchdog, nil
+	return finalizeConfig(conf)
 }
 
 func DefaultConfig() Config {
@@ -42,10 +139,627 @@ func DefaultConfig() Config {
 }
 
 type Config struct {
-	Version     string `toml:"version"`
-	ProcessType string `toml:"process_type"`
+	Version         string            `toml:"version"`
+	BinaryPath      string            `toml:"binary_path"`
+	ProcessType     string            `toml:"process_type"`
+	DefaultProcess  *bool             `toml:"default_process"`
+	Direct          *bool             `toml:"direct"`
+	Args            []string          `toml:"args"`
+	WorkingDir      string            `toml:"working_dir"`
+	Wrap            []string          `toml:"wrap"`
+	WrapAll         *bool             `toml:"wrap_all"`
+	Template        string            `toml:"template"`
+	Mode            string            `toml:"mode"`
+	StaticPath      string            `toml:"static_path"`
+	Env             map[string]string `toml:"env"`
+	Labels          map[string]string `toml:"labels"`
+	Annotations     map[string]string `toml:"annotations"`
+	Secrets         map[string]string `toml:"secrets"`
+	OptionalSecrets []string          `toml:"optional_secrets"`
+	Functions       []Function        `toml:"functions"`
+	Slices          []Slice           `toml:"slices"`
+	Profiles        map[string]Config `toml:"profiles"`
+
+	// Profile is the name of the profile applied to this configuration, if any.
+	Profile string `toml:"-"`
+	// Origins records where each value was defined. It is only populated by LoadConfig.
+	Origins Origins `toml:"-"`
+	// WebUpstream is the command of the application's web process replaced by the watchdog, if any. It is only
+	// populated by ResolveDefaultProcess.
+	WebUpstream string `toml:"-"`
+}
+
+// Origins maps the TOML key of each configuration value (e.g. 'version' or 'env.exec_timeout') to where it was defined:
+// a default, a configuration file or the platform env.
+type Origins map[string]string
+
+// Function is a function packaged into the image, served by its own watchdog process named 'faas-<name>'.
+type Function struct {
+	Name        string            `toml:"name"`
+	ProcessType string            `toml:"process_type"`
+	Port        int               `toml:"port"`
+	Env         map[string]string `toml:"env"`
+}
+
+// Slice is a launch slice, a set of globs relative to the application whose files are layered apart from the rest of
+// the application, so that changes to other files leave its layer unchanged.
+type Slice struct {
+	Paths []string `toml:"paths"`
+}
+
+// ConfigPaths discovers the configuration files present in appDir, ordered from lowest to highest precedence.
+//
+// A stack.yml, then a project.toml, at the root of appDir are always considered. The watchdog config file is configPath
+// when set, otherwise the first of the search paths (watchdog.toml, .openfaas/watchdog.toml) present. When both exist,
+// values in the watchdog config file take precedence over those in project.toml.
+func ConfigPaths(appDir string, configPath string) ([]ConfigSource, error) {
+	var sources []ConfigSource
+
+	stackPath := filepath.Join(appDir, stackConfigName)
+	if found, err := fileExists(stackPath); err != nil {
+		return nil, err
+	} else if found {
+		sources = append(sources, ConfigSource{Path: stackPath, Kind: StackConfig})
+	}
+
+	projectPath := filepath.Join(appDir, projectConfigName)
+	if found, err := fileExists(projectPath); err != nil {
+		return nil, err
+	} else if found {
+		sources = append(sources, ConfigSource{Path: projectPath, Kind: ProjectConfig})
+	}
+
+	if configPath != "" {
+		if !filepath.IsAbs(configPath) {
+			configPath = filepath.Join(appDir, configPath)
+		}
+
+		if found, err := fileExists(configPath); err != nil {
+			return nil, err
+		} else if !found {
+			return nil, fmt.Errorf("config file '%s' does not exist", configPath)
+		}
+
+		kind := WatchdogConfig
+		if filepath.Base(configPath) == projectConfigName {
+			kind = ProjectConfig
+		}
+
+		return append(sources, ConfigSource{Path: configPath, Kind: kind}), nil
+	}
+
+	for _, searchPath := range configSearchPaths {
+		path := filepath.Join(appDir, searchPath)
+		if found, err := fileExists(path); err != nil {
+			return nil, err
+		} else if found {
+			return append(sources, ConfigSource{Path: path, Kind: WatchdogConfig}), nil
+		}
+	}
+
+	return sources, nil
+}
+
+func fileExists(path string) (bool, error) {
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Declared reports whether any of the sources declares a watchdog configuration, i.e. a watchdog config file is present
+// or project.toml contains a watchdog table.
+func Declared(sources []ConfigSource) (bool, error) {
+	for _, source := range sources {
+		if source.Kind == WatchdogConfig {
+			return true, nil
+		}
+
+		if source.Kind == StackConfig {
+			continue
+		}
+
+		pTOML := &projectTOML{}
+		if _, err := toml.DecodeFile(source.Path, pTOML); err != nil {
+			return false, fmt.Errorf("reading '%s': %s", source.Path, err)
+		}
+
+		if pTOML.Metadata.OpenFaaS.Watchdog != nil || pTOML.IO.Buildpacks.OpenFaaS != nil {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// LoadConfig reads each of the sources in order, overlaying their values onto the default configuration. When profile
+// is not empty, the matching [watchdog.profiles.<name>] table is then overlaid onto the result, followed by any
+// BP_WATCHDOG_<KEY> overrides in env. Variable references are interpolated from env.
+func LoadConfig(sources []ConfigSource, profile string, env map[string]string) (Config, error) {
+	conf := Config{Origins: Origins{}}
+	for _, source := range sources {
+		sourceConf, err := readConfig(source, env)
+		if err != nil {
+			return conf, fmt.Errorf("reading '%s': %s", source.Path, err)
+		}
+
+		mergeConfig(&conf, sourceConf, source.origin())
+	}
+
+	conf, err := applyProfile(conf, profile)
+	if err != nil {
+		return conf, err
+	}
+
+	applyEnvOverrides(&conf, env)
+
+	return finalizeConfig(conf)
+}
+
+func readConfig(source ConfigSource, env map[string]string) (Config, error) {
+	fh, err := os.Open(source.Path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer fh.Close()
+
+	decode := decodeConfig
+	switch source.Kind {
+	case ProjectConfig:
+		decode = decodeProjectConfig
+	case StackConfig:
+		decode = decodeStackConfig
+	}
+
+	conf, err := decode(fh)
+	if err != nil {
+		return conf, err
+	}
+
+	if err := interpolateConfig(&conf, env); err != nil {
+		return conf, err
+	}
+
+	resolvePaths(&conf, filepath.Dir(source.Path))
+	return conf, nil
+}
+
+// resolvePaths resolves relative paths within conf against dir, the directory of the file it was read from.
+func resolvePaths(conf *Config, dir string) {
+	if conf.BinaryPath != "" && !filepath.IsAbs(conf.BinaryPath) {
+		conf.BinaryPath = filepath.Join(dir, conf.BinaryPath)
+	}
+
+	for name, profile := range conf.Profiles {
+		resolvePaths(&profile, dir)
+		conf.Profiles[name] = profile
+	}
 }
 
-func ConfigPath(appDir string) string {
-	return filepath.Join(appDir, configName)
+func decodeConfig(reader io.Reader) (Config, error) {
+	cTOML := &configTOML{}
+	if _, err := toml.DecodeReader(reader, &cTOML); err != nil {
+		return cTOML.Watchdog, err
+	}
+
+	return cTOML.Watchdog, nil
+}
+
+func decodeProjectConfig(reader io.Reader) (Config, error) {
+	pTOML := &projectTOML{}
+	if _, err := toml.DecodeReader(reader, &pTOML); err != nil {
+		return Config{}, err
+	}
+
+	metadataConf, ioConf := pTOML.Metadata.OpenFaaS.Watchdog, pTOML.IO.Buildpacks.OpenFaaS
+	switch {
+	case metadataConf != nil && ioConf != nil:
+		return Config{}, errors.New("only one of [metadata.openfaas.watchdog] or [io.buildpacks.openfaas] may be declared")
+	case metadataConf != nil:
+		return *metadataConf, nil
+	case ioConf != nil:
+		return *ioConf, nil
+	default:
+		return Config{}, nil
+	}
+}
+
+// finalizeConfig applies defaults to any unset values and validates the result.
+func finalizeConfig(conf Config) (Config, error) {
+	if conf.Version == "" {
+		conf.Version = defaultVersion
+		conf.record("version", OriginDefault)
+	}
+
+	if conf.ProcessType == "" {
+		conf.ProcessType = defaultProcessType
+		conf.record("process_type", OriginDefault)
+	}
+
+	for i := range conf.Functions {
+		if conf.Functions[i].ProcessType == "" {
+			conf.Functions[i].ProcessType = conf.ProcessType
+		}
+	}
+
+	return conf, conf.validate()
+}
+
+func (c Config) validate() error {
+	if !namePattern.MatchString(c.Version) {
+		return fmt.Errorf("invalid version '%s'", c.Version)
+	}
+
+	if err := validateName("process_type", c.ProcessType); err != nil {
+		return err
+	}
+
+	if err := validateEnv("env var", c.Env); err != nil {
+		return err
+	}
+
+	if err := validateLaunchReferences(c); err != nil {
+		return err
+	}
+
+	if c.Mode != "" && !contains(modes, c.Mode) {
+		return fmt.Errorf("invalid mode '%s': must be one of [%s]", c.Mode, strings.Join(modes, ", "))
+	}
+
+	if c.Mode == StaticMode {
+		if c.StaticPath == "" {
+			return fmt.Errorf("mode '%s' requires static_path", StaticMode)
+		}
+
+		if isSet(c.WrapAll) || len(c.Wrap) > 0 {
+			return fmt.Errorf("process types may not be wrapped in mode '%s'", StaticMode)
+		}
+	} else if c.StaticPath != "" {
+		return fmt.Errorf("static_path requires mode '%s'", StaticMode)
+	}
+
+	if c.Template != "" {
+		if _, err := template.Lookup(c.Template); err != nil {
+			return err
+		}
+	}
+
+	if err := validateProfiles(c.Profiles); err != nil {
+		return err
+	}
+
+	for _, labels := range []map[string]string{c.Labels, c.Annotations} {
+		for key := range labels {
+			if key == "" {
+				return errors.New("label and annotation keys may not be empty")
+			}
+		}
+	}
+
+	if err := validateSecrets(c.Secrets, c.OptionalSecrets); err != nil {
+		return err
+	}
+
+	if isSet(c.WrapAll) && len(c.Wrap) > 0 {
+		return errors.New("only one of wrap or wrap_all may be set")
+	}
+
+	wrapped := map[string]bool{}
+	for _, wrappedType := range c.Wrap {
+		if err := validateName("wrapped process type", wrappedType); err != nil {
+			return err
+		}
+
+		if wrapped[wrappedType] {
+			return fmt.Errorf("process type '%s' is wrapped more than once", wrappedType)
+		}
+		wrapped[wrappedType] = true
+	}
+
+	for i, slice := range c.Slices {
+		if len(slice.Paths) == 0 {
+			return fmt.Errorf("slice %d has no paths", i)
+		}
+
+		for _, path := range slice.Paths {
+			if filepath.IsAbs(path) || path == ".." || strings.HasPrefix(filepath.ToSlash(path), "../") {
+				return fmt.Errorf("invalid slice path '%s': must be relative to the application", path)
+			}
+
+			if _, err := filepath.Match(path, ""); err != nil {
+				return fmt.Errorf("invalid slice path '%s': %s", path, err)
+			}
+		}
+	}
+
+	if isSet(c.DefaultProcess) && len(c.Functions) > 0 {
+		return errors.New("default_process may not be set when functions are declared")
+	}
+
+	names := map[string]bool{}
+	for _, function := range c.Functions {
+		if err := validateName("function name", function.Name); err != nil {
+			return err
+		}
+
+		if names[function.Name] {
+			return fmt.Errorf("function '%s' is declared more than once", function.Name)
+		}
+		names[function.Name] = true
+
+		if !namePattern.MatchString(function.ProcessType) {
+			return fmt.Errorf("invalid process_type '%s' for function '%s'", function.ProcessType, function.Name)
+		}
+
+		if function.Port < 0 || function.Port > 65535 {
+			return fmt.Errorf("invalid port '%d' for function '%s'", function.Port, function.Name)
+		}
+
+		if err := validateEnv(fmt.Sprintf("env var for function '%s'", function.Name), function.Env); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyProfile overlays the named profile onto the base configuration. An empty name returns the base configuration
+// unchanged.
+func applyProfile(conf Config, name string) (Config, error) {
+	if err := validateProfiles(conf.Profiles); err != nil {
+		return conf, err
+	}
+
+	if name == "" {
+		return conf, nil
+	}
+
+	profile, ok := conf.Profiles[name]
+	if !ok {
+		var available []string
+		for profileName := range conf.Profiles {
+			available = append(available, profileName)
+		}
+		sort.Strings(available)
+
+		return conf, fmt.Errorf("profile '%s' not found, available profiles: [%s]", name, strings.Join(available, ", "))
+	}
+
+	origin := ""
+	if conf.Origins != nil {
+		origin = fmt.Sprintf("%s (profile '%s')", conf.Origins["profiles."+name], name)
+	}
+
+	merged := Config{Origins: conf.Origins}
+	mergeConfig(&merged, conf, "")
+	mergeConfig(&merged, profile, origin)
+	merged.Profiles = nil
+	merged.Profile = name
+
+	return merged, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateName fails when value, described by what, isn't a valid name.
+func validateName(what string, value string) error {
+	if !namePattern.MatchString(value) {
+		return fmt.Errorf("invalid %s '%s': may only contain letters, numbers, '.', '_' and '-'", what, value)
+	}
+
+	return nil
+}
+
+// validateEnv fails when a key of env, described by what, isn't a valid environment variable name, as it is exported
+// by the launchers.
+func validateEnv(what string, env map[string]string) error {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !envNamePattern.MatchString(key) {
+			return fmt.Errorf(
+				"invalid %s '%s': must start with a letter or '_', and only contain letters, numbers and '_'", what, key,
+			)
+		}
+	}
+
+	return nil
+}
+
+// validateLaunchReferences fails when a value other than an env var has a launch-time reference, escaped as '$${VAR}',
+// since only env vars are expanded when the container starts.
+func validateLaunchReferences(c Config) error {
+	values := map[string]string{"working_dir": c.WorkingDir, "static_path": c.StaticPath}
+	for i, arg := range c.Args {
+		values[fmt.Sprintf("args[%d]", i)] = arg
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if hasReferences(values[key]) {
+			return fmt.Errorf("invalid %s '%s': launch-time references are only expanded in env", key, values[key])
+		}
+	}
+
+	return nil
+}
+
+// isSet reports whether an optional flag, which a higher-precedence source or profile may turn off, is set to true.
+func isSet(flag *bool) bool {
+	return flag != nil && *flag
+}
+
+func validateProfiles(profiles map[string]Config) error {
+	for name, profile := range profiles {
+		if len(profile.Profiles) > 0 {
+			return fmt.Errorf("profile '%s' may not declare profiles", name)
+		}
+	}
+
+	return nil
+}
+
+// validateSecrets checks that each secret is exported as a valid environment variable of its own, and that the optional
+// secrets are declared.
+func validateSecrets(secrets map[string]string, optional []string) error {
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	exported := map[string]string{}
+	for _, name := range names {
+		env := secrets[name]
+		if err := validateName("secret name", name); err != nil {
+			return err
+		}
+
+		if !envNamePattern.MatchString(env) {
+			return fmt.Errorf("invalid environment variable '%s' for secret '%s'", env, name)
+		}
+
+		if previous, ok := exported[env]; ok {
+			return fmt.Errorf("secrets '%s' and '%s' are both exported as %s", previous, name, env)
+		}
+		exported[env] = name
+	}
+
+	for _, name := range optional {
+		if _, ok := secrets[name]; !ok {
+			return fmt.Errorf("optional secret '%s' is not declared in secrets", name)
+		}
+	}
+
+	return nil
+}
+
+// ApplyShim sets the watchdog mode, env and process type required by a generated shim, unless they are configured
+// explicitly. A shim built by the language buildpack can't be combined with default_process, since the buildpack must
+// precede the language buildpack to generate it, but follow it for its default process to be the last one declared.
+func ApplyShim(conf Config, s shim.Shim) (Config, error) {
+	origin := fmt.Sprintf("template '%s'", s.Template.Name)
+
+	if s.Build && isSet(conf.DefaultProcess) {
+		return conf, fmt.Errorf(
+			"default_process is not supported with the generated '%s' entrypoint, which is built by the %s buildpack "+
+				"ordered after this one: unset default_process, or provide a main package",
+			s.Template.Name, s.Template.Language,
+		)
+	}
+
+	if s.ProcessType != "" && conf.origin("process_type") == OriginDefault {
+		conf.ProcessType = s.ProcessType
+		conf.record("process_type", origin)
+	}
+
+	if conf.Mode == "" && s.Mode != "" {
+		conf.Mode = s.Mode
+		conf.record("mode", origin)
+	}
+
+	env := map[string]string{}
+	for key, value := range conf.Env {
+		env[key] = value
+	}
+	for key, value := range s.Env {
+		if _, ok := env[key]; !ok {
+			env[key] = value
+			conf.record("env."+key, origin)
+		}
+	}
+	if len(env) > 0 {
+		conf.Env = env
+	}
+
+	return conf, nil
+}
+
+// ApplyTemplate sets the default launch slices of tmpl, unless slices are configured explicitly.
+func ApplyTemplate(conf Config, tmpl template.Template) Config {
+	if len(conf.Slices) > 0 || len(tmpl.Slices) == 0 {
+		return conf
+	}
+
+	for _, paths := range tmpl.Slices {
+		conf.Slices = append(conf.Slices, Slice{Paths: paths})
+	}
+	conf.record("slices", fmt.Sprintf("template '%s'", tmpl.Name))
+
+	return conf
+}
+
+// applyEnvOverrides overrides the values of envOverrides with the matching BP_WATCHDOG_<KEY> variable in env, e.g.
+// BP_WATCHDOG_VERSION for 'version'.
+func applyEnvOverrides(conf *Config, env map[string]string) {
+	for _, key := range envOverrides {
+		value, ok := env[overrideEnvPrefix+strings.ToUpper(key)]
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "version":
+			conf.Version = value
+		case "process_type":
+			conf.ProcessType = value
+		}
+		conf.record(key, OriginPlatformEnv)
+	}
+}
+
+// mergeConfig overlays the values set in src onto dst, recording origin as the origin of each value when not empty.
+// Maps are merged key by key, all other values are replaced.
+func mergeConfig(dst *Config, src Config, origin string) {
+	dstValue := reflect.ValueOf(dst).Elem()
+	srcValue := reflect.ValueOf(src)
+
+	for i := 0; i < srcValue.NumField(); i++ {
+		field := srcValue.Field(i)
+		tag := srcValue.Type().Field(i).Tag.Get("toml")
+		if tag == "-" || field.IsZero() {
+			continue
+		}
+
+		if field.Kind() == reflect.Map {
+			if dstValue.Field(i).IsNil() {
+				dstValue.Field(i).Set(reflect.MakeMap(field.Type()))
+			}
+			for _, key := range field.MapKeys() {
+				dstValue.Field(i).SetMapIndex(key, field.MapIndex(key))
+				dst.record(fmt.Sprintf("%s.%v", tag, key), origin)
+			}
+			continue
+		}
+
+		dstValue.Field(i).Set(field)
+		dst.record(tag, origin)
+	}
+}
+
+func (c *Config) record(key string, origin string) {
+	if c.Origins != nil && origin != "" {
+		c.Origins[key] = origin
+	}
 }
@@ -0,0 +1,120 @@
+package watchdog
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/buildpacks/libbuildpack/v2/buildplan"
+
+	"github.com/jromero/openfaas-cnb/pkg/template"
+)
+
+// EnabledEnv is the platform environment variable explicitly opting in to (true), or out of (false), the buildpack.
+const EnabledEnv = "BP_OPENFAAS_ENABLED"
+
+// Detection is the outcome of detecting whether the buildpack applies to an application.
+type Detection struct {
+	// Plans are the build plans to pass with, most preferred first. There are none when detection fails.
+	Plans []buildplan.Plan
+	// Template is the name of the configured or recognised function template, if any.
+	Template string
+	// Reason explains why detection failed.
+	Reason string
+}
+
+// Passed reports whether the buildpack applies to the application.
+func (d Detection) Passed() bool {
+	return len(d.Plans) > 0
+}
+
+// ConfigError is an error in the platform environment or the watchdog config found during detection.
+type ConfigError struct {
+	Err error
+}
+
+func (e ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+// Detect detects whether the buildpack applies to the application in appDir, given the platform env. It applies when
+// opted in with EnabledEnv, when a watchdog config is declared or when a function template is configured or
+// recognised, unless opted out.
+//
+// The plan provides and requires the watchdog. Only an explicitly requested version is a constraint, so that other
+// buildpacks may require another version. When a template is found, the plan requiring its language is preferred, with
+// the plain plan as a fallback for groups without a buildpack providing the language.
+func Detect(appDir string, env map[string]string) (Detection, error) {
+	enabled, optedIn := true, false
+	if value, ok := env[EnabledEnv]; ok {
+		var err error
+		if enabled, err = strconv.ParseBool(value); err != nil {
+			return Detection{}, ConfigError{fmt.Errorf("invalid %s '%s'", EnabledEnv, value)}
+		}
+		optedIn = enabled
+	}
+
+	if !enabled {
+		return Detection{Reason: EnabledEnv + " is false"}, nil
+	}
+
+	sources, err := ConfigPaths(appDir, env[ConfigEnv])
+	if err != nil {
+		return Detection{}, ConfigError{err}
+	}
+
+	declared, err := Declared(sources)
+	if err != nil {
+		return Detection{}, ConfigError{err}
+	}
+
+	conf, err := LoadConfig(sources, env[ProfileEnv], env)
+	if err != nil {
+		return Detection{}, ConfigError{err}
+	}
+
+	tmpl, recognised, err := functionTemplate(appDir, conf)
+	if err != nil {
+		return Detection{}, err
+	}
+
+	if !optedIn && !declared && !recognised {
+		return Detection{Reason: "no watchdog config or function layout found"}, nil
+	}
+
+	metadata := buildplan.Metadata{}
+	if conf.origin("version") != OriginDefault {
+		metadata["version"] = conf.Version
+	}
+
+	plan := buildplan.Plan{
+		Provides: []buildplan.Provided{{Name: PlanEntryName}},
+		Requires: []buildplan.Required{{
+			Name:     PlanEntryName,
+			Metadata: metadata,
+		}},
+	}
+
+	if !recognised {
+		return Detection{Plans: []buildplan.Plan{plan}}, nil
+	}
+
+	metadata["template"] = tmpl.Name
+
+	withLanguage := plan
+	withLanguage.Requires = append([]buildplan.Required{{Name: tmpl.Language}}, plan.Requires...)
+
+	return Detection{Plans: []buildplan.Plan{withLanguage, plan}, Template: tmpl.Name}, nil
+}
+
+// functionTemplate returns the configured template, or the template recognised from the layout of appDir.
+func functionTemplate(appDir string, conf Config) (template.Template, bool, error) {
+	if conf.Template != "" {
+		tmpl, err := template.Lookup(conf.Template)
+		if err != nil {
+			return tmpl, false, ConfigError{err}
+		}
+		return tmpl, true, nil
+	}
+
+	return template.Detect(appDir)
+}
@@ -0,0 +1,71 @@
+package watchdog
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ExplainEnv is the platform environment variable enabling the explanation of the effective configuration.
+const ExplainEnv = "BP_WATCHDOG_EXPLAIN"
+
+// Explain describes the effective configuration, one value per line, each annotated with the origin recorded for it.
+func Explain(conf Config) string {
+	var lines []string
+	explainValue(reflect.ValueOf(conf), "", func(key string, value interface{}) {
+		lines = append(lines, fmt.Sprintf("%s = %#v (%s)", key, value, conf.origin(key)))
+	})
+
+	return strings.Join(lines, "\n")
+}
+
+// origin returns the origin recorded for key, or for the closest of its parents, such as 'functions' for
+// 'functions[0].name'.
+func (c Config) origin(key string) string {
+	for {
+		if origin, ok := c.Origins[key]; ok {
+			return origin
+		}
+
+		idx := strings.LastIndexAny(key, ".[")
+		if idx < 0 {
+			return "unknown"
+		}
+		key = key[:idx]
+	}
+}
+
+func explainValue(value reflect.Value, key string, explain func(key string, value interface{})) {
+	switch value.Kind() {
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			tag := value.Type().Field(i).Tag.Get("toml")
+			if tag == "-" || value.Field(i).IsZero() {
+				continue
+			}
+
+			fieldKey := tag
+			if key != "" {
+				fieldKey = key + "." + tag
+			}
+			explainValue(value.Field(i), fieldKey, explain)
+		}
+	case reflect.Ptr:
+		explainValue(value.Elem(), key, explain)
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			explainValue(value.Index(i), fmt.Sprintf("%s[%d]", key, i), explain)
+		}
+	case reflect.Map:
+		keys := value.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+		})
+		for _, mapKey := range keys {
+			explainValue(value.MapIndex(mapKey), fmt.Sprintf("%s.%v", key, mapKey), explain)
+		}
+	default:
+		explain(key, value.Interface())
+	}
+}
@@ -0,0 +1,139 @@
+package watchdog
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+var variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// interpolateConfig expands variable references within every string value of conf using env.
+func interpolateConfig(conf *Config, env map[string]string) error {
+	return interpolateValue(reflect.ValueOf(conf).Elem(), "watchdog", env)
+}
+
+func interpolateValue(value reflect.Value, key string, env map[string]string) error {
+	switch value.Kind() {
+	case reflect.String:
+		expanded, err := interpolate(value.String(), env)
+		if err != nil {
+			return fmt.Errorf("interpolating '%s': %s", key, err)
+		}
+		value.SetString(expanded)
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			tag := field.Tag.Get("toml")
+			if field.PkgPath != "" || tag == "-" {
+				continue
+			}
+
+			if err := interpolateValue(value.Field(i), key+"."+tag, env); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			if err := interpolateValue(value.Index(i), fmt.Sprintf("%s[%d]", key, i), env); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, mapKey := range value.MapKeys() {
+			elem := reflect.New(value.Type().Elem()).Elem()
+			elem.Set(value.MapIndex(mapKey))
+			if err := interpolateValue(elem, fmt.Sprintf("%s.%v", key, mapKey), env); err != nil {
+				return err
+			}
+			value.SetMapIndex(mapKey, elem)
+		}
+	}
+
+	return nil
+}
+
+// interpolate expands ${VAR} and ${VAR:-default} references in value using env. The default is used when VAR is unset
+// or empty. '$$' escapes a literal '$', so that references meant for launch time, such as '$${PORT}', are passed
+// through as '${PORT}'.
+func interpolate(value string, env map[string]string) (string, error) {
+	result := &strings.Builder{}
+
+	err := walkReferences(value, func(literal string) {
+		result.WriteString(literal)
+	}, func(name string, def string, hasDefault bool) error {
+		if value := env[name]; value != "" {
+			result.WriteString(value)
+			return nil
+		}
+
+		if !hasDefault {
+			return fmt.Errorf("variable '%s' is not set", name)
+		}
+
+		result.WriteString(def)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return result.String(), nil
+}
+
+// walkReferences calls literal with the literal text of value, and reference with each of its ${VAR} or
+// ${VAR:-default} references, in order. '$$' is a literal '$'.
+func walkReferences(
+	value string,
+	literal func(text string),
+	reference func(name string, def string, hasDefault bool) error,
+) error {
+	for i := 0; i < len(value); i++ {
+		if value[i] != '$' || i+1 == len(value) {
+			literal(value[i : i+1])
+			continue
+		}
+
+		switch value[i+1] {
+		case '$':
+			literal("$")
+			i++
+		case '{':
+			end := strings.IndexByte(value[i:], '}')
+			if end < 0 {
+				return fmt.Errorf("unterminated reference in '%s'", value)
+			}
+
+			name, def, hasDefault := value[i+2:i+end], "", false
+			if idx := strings.Index(name, ":-"); idx >= 0 {
+				name, def, hasDefault = name[:idx], name[idx+2:], true
+			}
+
+			if !variableNamePattern.MatchString(name) {
+				return fmt.Errorf("invalid variable name '%s'", name)
+			}
+
+			if err := reference(name, def, hasDefault); err != nil {
+				return err
+			}
+			i += end
+		default:
+			literal("$")
+		}
+	}
+
+	return nil
+}
+
+// hasReferences reports whether value still references variables, which, once the configuration is interpolated, are
+// launch-time references such as '${PORT}'.
+func hasReferences(value string) bool {
+	return strings.Contains(value, "${")
+}
+
+// ExpandReferences expands the launch-time references of value, such as '${PORT}', using env, the environment of the
+// container. As at build time, a reference without a default fails when the variable is unset or empty.
+func ExpandReferences(value string, env map[string]string) (string, error) {
+	return interpolate(value, env)
+}
@@ -0,0 +1,113 @@
+package watchdog
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/buildpacks/libbuildpack/v2/buildpackplan"
+
+	"github.com/jromero/openfaas-cnb/pkg/template"
+)
+
+// OriginBuildPlan is the origin of values resolved from the build plan.
+const OriginBuildPlan = "build plan"
+
+// ResolvePlan resolves the watchdog version from conf and the version constraints of the build plan entries, as
+// required by this or other buildpacks, returning the resolved config and the plan entry met by the build. The
+// template recognised during detection is used unless one is configured.
+//
+// A constraint is an exact version (e.g. '0.7.6'), a version with wildcard segments (e.g. '0.7.*' or '0.x') or '*'.
+// An explicitly configured version must satisfy every constraint. Otherwise, an exact version required by the build
+// plan is used in place of the default.
+func ResolvePlan(conf Config, entries []buildpackplan.Plan) (Config, buildpackplan.Plan, error) {
+	var constraints []string
+	for _, entry := range entries {
+		if entry.Name != PlanEntryName {
+			continue
+		}
+
+		if entry.Version != "" {
+			constraints = append(constraints, entry.Version)
+		}
+
+		if version, ok := entry.Metadata["version"].(string); ok && version != "" {
+			constraints = append(constraints, version)
+		}
+
+		if name, ok := entry.Metadata["template"].(string); ok && name != "" && conf.Template == "" {
+			conf.Template = name
+			conf.record("template", OriginBuildPlan)
+		}
+	}
+
+	if conf.origin("version") == OriginDefault {
+		for _, constraint := range constraints {
+			if isExactVersion(constraint) {
+				conf.Version = constraint
+				conf.record("version", OriginBuildPlan)
+				break
+			}
+		}
+	}
+
+	for _, constraint := range constraints {
+		if !versionMatches(constraint, conf.Version) {
+			return conf, buildpackplan.Plan{}, fmt.Errorf(
+				"watchdog version '%s' (%s) does not satisfy constraint '%s' required by the build plan",
+				conf.Version, conf.origin("version"), constraint,
+			)
+		}
+	}
+
+	metadata := buildpackplan.Metadata{"version": conf.Version}
+	if conf.Template != "" {
+		if _, err := template.Lookup(conf.Template); err != nil {
+			return conf, buildpackplan.Plan{}, err
+		}
+		metadata["template"] = conf.Template
+	}
+
+	return conf, buildpackplan.Plan{
+		Name:     PlanEntryName,
+		Version:  conf.Version,
+		Metadata: metadata,
+	}, nil
+}
+
+func isExactVersion(constraint string) bool {
+	for _, segment := range strings.Split(constraint, ".") {
+		if isWildcard(segment) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// versionMatches reports whether version satisfies constraint, segment by segment.
+func versionMatches(constraint string, version string) bool {
+	if isWildcard(constraint) {
+		return true
+	}
+
+	constraintSegments := strings.Split(constraint, ".")
+	versionSegments := strings.Split(version, ".")
+	for i, segment := range constraintSegments {
+		if isWildcard(segment) {
+			if i == len(constraintSegments)-1 {
+				return len(versionSegments) > i
+			}
+			continue
+		}
+
+		if i >= len(versionSegments) || segment != versionSegments[i] {
+			return false
+		}
+	}
+
+	return len(constraintSegments) == len(versionSegments)
+}
+
+func isWildcard(segment string) bool {
+	return segment == "*" || segment == "x" || segment == "X"
+}
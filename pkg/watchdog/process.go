@@ -0,0 +1,232 @@
+package watchdog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+const (
+	procfileName = "Procfile"
+	// profileName is the application's profile script, only sourced by the launcher for processes run through a shell.
+	profileName = ".profile"
+)
+
+const (
+	// WebProcessType is the process type run when none is selected, replaced by the watchdog with default_process.
+	WebProcessType = "web"
+	// WebUpstreamProcessType is the process type the application's replaced web process is re-declared as.
+	WebUpstreamProcessType = "web-upstream"
+)
+
+const (
+	// OriginDefaultProcess is the origin of values pointed at WebUpstreamProcessType, as default_process replaces web.
+	OriginDefaultProcess = "default_process"
+	// OriginProcessTypes is the origin of a process type picked as the only one defined by the application.
+	OriginProcessTypes = "only defined process type"
+	// OriginProfile is the origin of direct when disabled to source the application's .profile.
+	OriginProfile = "application .profile"
+)
+
+var procfileLinePattern = regexp.MustCompile(`^([A-Za-z0-9_-]+):\s*\S`)
+
+type processesTOML struct {
+	IO struct {
+		Buildpacks struct {
+			Processes []struct {
+				Type    string `toml:"type"`
+				Command string `toml:"command"`
+			} `toml:"processes"`
+		} `toml:"buildpacks"`
+	} `toml:"io"`
+}
+
+// ProcessTypes returns the sorted process types defined by the application, in its Procfile and the
+// [[io.buildpacks.processes]] tables of its project.toml.
+func ProcessTypes(appDir string) ([]string, error) {
+	commands, err := ProcessCommands(appDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var sorted []string
+	for processType := range commands {
+		sorted = append(sorted, processType)
+	}
+	sort.Strings(sorted)
+
+	return sorted, nil
+}
+
+// ProcessCommands returns the commands of the process types defined by the application, in its Procfile and the
+// [[io.buildpacks.processes]] tables of its project.toml, which take precedence.
+func ProcessCommands(appDir string) (map[string]string, error) {
+	commands, err := readProcfile(filepath.Join(appDir, procfileName))
+	if err != nil {
+		return nil, fmt.Errorf("reading '%s': %s", procfileName, err)
+	}
+
+	projectPath := filepath.Join(appDir, projectConfigName)
+	if found, err := fileExists(projectPath); err != nil {
+		return nil, err
+	} else if found {
+		pTOML := &processesTOML{}
+		if _, err := toml.DecodeFile(projectPath, pTOML); err != nil {
+			return nil, fmt.Errorf("reading '%s': %s", projectConfigName, err)
+		}
+
+		for _, process := range pTOML.IO.Buildpacks.Processes {
+			if process.Type != "" {
+				commands[process.Type] = process.Command
+			}
+		}
+	}
+
+	return commands, nil
+}
+
+func readProcfile(path string) (map[string]string, error) {
+	commands := map[string]string{}
+
+	fh, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return commands, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		match := procfileLinePattern.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("invalid process definition '%s'", line)
+		}
+		commands[match[1]] = strings.TrimSpace(line[len(match[1])+1:])
+	}
+
+	return commands, scanner.Err()
+}
+
+// ResolveProcessType checks that the process types run by the watchdog are among types, the process types available
+// at launch. When the process type isn't configured and there is exactly one available, it is used instead of the
+// default. With wrap_all, every available process type is wrapped. In StaticMode, there is no process type to run, so
+// only those of functions are checked. When types is empty, the available process types are unknown (e.g. they are
+// contributed by other buildpacks), so they aren't checked.
+func ResolveProcessType(conf Config, types []string) (Config, error) {
+	if isSet(conf.WrapAll) {
+		if len(types) == 0 {
+			return conf, errors.New("wrap_all requires the application to define its process types")
+		}
+
+		conf.Wrap = append([]string(nil), types...)
+		conf.record("wrap", conf.origin("wrap_all"))
+	}
+
+	if len(types) == 0 {
+		return conf, nil
+	}
+
+	// static mode has no upstream process type
+	if conf.Mode != StaticMode {
+		if len(types) == 1 && conf.origin("process_type") == OriginDefault && conf.ProcessType != types[0] {
+			for i := range conf.Functions {
+				if conf.Functions[i].ProcessType == conf.ProcessType {
+					conf.Functions[i].ProcessType = types[0]
+				}
+			}
+
+			conf.ProcessType = types[0]
+			conf.record("process_type", OriginProcessTypes)
+		}
+
+		if !contains(types, conf.ProcessType) {
+			return conf, processTypeNotFound(conf.ProcessType, conf.origin("process_type"), types)
+		}
+	}
+
+	for i, function := range conf.Functions {
+		if !contains(types, function.ProcessType) {
+			origin := conf.origin(fmt.Sprintf("functions[%d].process_type", i))
+			return conf, processTypeNotFound(function.ProcessType, origin, types)
+		}
+	}
+
+	for i, wrappedType := range conf.Wrap {
+		if !contains(types, wrappedType) {
+			return conf, processTypeNotFound(wrappedType, conf.origin(fmt.Sprintf("wrap[%d]", i)), types)
+		}
+	}
+
+	return conf, nil
+}
+
+func processTypeNotFound(processType string, origin string, types []string) error {
+	return fmt.Errorf(
+		"process type '%s' (%s) not found, available process types: [%s]",
+		processType, origin, strings.Join(types, ", "),
+	)
+}
+
+// ResolveDirect defaults direct, so that the watchdog processes are exec'd directly and receive signals, unless the
+// application has a .profile script, which the launcher only sources for processes run through a shell.
+func ResolveDirect(conf Config, appDir string) (Config, error) {
+	if conf.Direct != nil {
+		return conf, nil
+	}
+
+	found, err := fileExists(filepath.Join(appDir, profileName))
+	if err != nil {
+		return conf, err
+	}
+
+	direct := !found
+	conf.Direct = &direct
+	if found {
+		conf.record("direct", OriginProfile)
+	} else {
+		conf.record("direct", OriginDefault)
+	}
+
+	return conf, nil
+}
+
+// ResolveDefaultProcess prepares default_process to replace the application's web process, the one launched when no
+// process type is selected, with the watchdog. When the application defines web itself, its command is re-declared as
+// WebUpstreamProcessType, which the watchdog runs instead of web, also when web is wrapped. Otherwise, web is contributed by another buildpack
+// with a command unknown at this point, so it isn't replaced and only the watchdog's 'faas' process is the default.
+func ResolveDefaultProcess(conf Config, appDir string) (Config, error) {
+	if !isSet(conf.DefaultProcess) {
+		return conf, nil
+	}
+
+	commands, err := ProcessCommands(appDir)
+	if err != nil {
+		return conf, err
+	}
+
+	command, ok := commands[WebProcessType]
+	if !ok {
+		return conf, nil
+	}
+	conf.WebUpstream = command
+
+	if conf.ProcessType == WebProcessType {
+		conf.ProcessType = WebUpstreamProcessType
+		conf.record("process_type", OriginDefaultProcess)
+	}
+
+	return conf, nil
+}
@@ -0,0 +1,77 @@
+package watchdog
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// Schema generates a JSON Schema describing watchdog.toml from Config and its nested types.
+func Schema() ([]byte, error) {
+	definitions := map[string]interface{}{}
+	schema := map[string]interface{}{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title":   "watchdog.toml",
+		"type":    "object",
+		"properties": map[string]interface{}{
+			"watchdog": typeSchema(reflect.TypeOf(Config{}), definitions),
+		},
+		"additionalProperties": false,
+		"definitions":          definitions,
+	}
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// typeSchema returns the schema for t. Structs are added to definitions, and referenced, so that recursive types
+// such as Config's profiles are supported.
+func typeSchema(t reflect.Type, definitions map[string]interface{}) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": typeSchema(t.Elem(), definitions),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": typeSchema(t.Elem(), definitions),
+		}
+	case reflect.Ptr:
+		return typeSchema(t.Elem(), definitions)
+	case reflect.Struct:
+		ref := map[string]interface{}{"$ref": "#/definitions/" + t.Name()}
+		if _, ok := definitions[t.Name()]; ok {
+			return ref
+		}
+
+		properties := map[string]interface{}{}
+		definition := map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+		definitions[t.Name()] = definition
+
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("toml")
+			if field.PkgPath != "" || tag == "-" || tag == "" {
+				continue
+			}
+			properties[tag] = typeSchema(field.Type, definitions)
+		}
+
+		return ref
+	default:
+		return map[string]interface{}{}
+	}
+}
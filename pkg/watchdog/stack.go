@@ -0,0 +1,43 @@
+package watchdog
+
+import (
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+const stackConfigName = "stack.yml"
+
+type stackYAML struct {
+	Functions map[string]stackFunction `yaml:"functions"`
+}
+
+type stackFunction struct {
+	Handler     string            `yaml:"handler"`
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// decodeStackConfig reads the labels and annotations of the function built from the application: the only function
+// of the stack.yml, or the one whose handler is the application itself.
+func decodeStackConfig(reader io.Reader) (Config, error) {
+	b, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return Config{}, err
+	}
+
+	stack := &stackYAML{}
+	if err := yaml.Unmarshal(b, stack); err != nil {
+		return Config{}, err
+	}
+
+	for _, function := range stack.Functions {
+		if len(stack.Functions) == 1 || filepath.Clean(function.Handler) == "." {
+			return Config{Labels: function.Labels, Annotations: function.Annotations}, nil
+		}
+	}
+
+	return Config{}, nil
+}
@@ -0,0 +1,40 @@
+package watchdog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ResolveStaticPath resolves static_path, relative to appDir, when serving in StaticMode, failing when it isn't an
+// existing directory of the application.
+func ResolveStaticPath(conf Config, appDir string) (Config, error) {
+	if conf.Mode != StaticMode {
+		return conf, nil
+	}
+
+	relative := filepath.Clean(conf.StaticPath)
+	if filepath.IsAbs(relative) || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return conf, ConfigError{fmt.Errorf(
+			"static_path '%s' (%s) must be relative to the application, and within it",
+			conf.StaticPath, conf.origin("static_path"),
+		)}
+	}
+
+	path := filepath.Join(appDir, relative)
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return conf, fmt.Errorf("static_path '%s' (%s) does not exist", conf.StaticPath, conf.origin("static_path"))
+	} else if err != nil {
+		return conf, err
+	}
+
+	if !info.IsDir() {
+		return conf, fmt.Errorf("static_path '%s' (%s) is not a directory", conf.StaticPath, conf.origin("static_path"))
+	}
+
+	conf.StaticPath = path
+	return conf, nil
+}
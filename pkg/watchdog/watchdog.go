@@ -4,20 +4,43 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/buildpacks/libbuildpack/v2/layers"
 	"github.com/buildpacks/libbuildpack/v2/logger"
+
+	"github.com/jromero/openfaas-cnb/pkg/launch"
+	"github.com/jromero/openfaas-cnb/pkg/version"
 )
 
+// PlanEntryName is the name of the build plan entry provided, and required, for the watchdog.
+const PlanEntryName = "openfaas-watchdog"
+
+// ExpandEnv is the launch environment variable listing, comma separated, the watchdog env vars with launch-time
+// references, expanded when the container starts.
+const ExpandEnv = "OPENFAAS_EXPAND_ENV"
+
 const (
-	executableName = "watchdog"
+	contributorName = "watchdog"
+	executableName  = "watchdog"
+	functionsDir    = "functions"
+	processType     = "faas"
+	// labelPrefix prefixes the standard labels describing the watchdog.
+	labelPrefix = "com.openfaas."
+	// annotationPrefix prefixes the label of each annotation, as images have no annotations of their own.
+	annotationPrefix = "com.openfaas.annotations."
 )
 
 type metadata struct {
 	Version string
+	Profile string
+	Config  Config
 }
 
 type HttpClient interface {
@@ -36,28 +59,43 @@ func NewContributor(log logger.Logger, httpClient HttpClient) *Contributor {
 	}
 }
 
-func (l *Contributor) Contribute(lyrs layers.Layers, conf Config) (*layers.Layer, error) {
+// Contribute installs the watchdog into its layer and adds the processes launching it to launchMetadata.
+func (l *Contributor) Contribute(lyrs layers.Layers, launchMetadata *launch.Metadata, conf Config) (*layers.Layer, error) {
 	watchdogLayer := lyrs.Layer(executableName)
 
-	if err := l.installBinaries(watchdogLayer, conf.Version); err != nil {
+	if err := l.installBinaries(watchdogLayer, launchMetadata.API(), conf); err != nil {
 		return nil, err
 	}
 
-	if err := l.configureApp(lyrs, watchdogLayer, conf.ProcessType); err != nil {
+	if err := l.configureApp(launchMetadata, watchdogLayer, conf); err != nil {
+		return nil, err
+	}
+
+	entry, err := bomEntry(watchdogLayer, conf)
+	if err != nil {
+		return nil, errors.New("describing binary: " + err.Error())
+	}
+	launchMetadata.AddBOM(entry)
+
+	if err := launch.WriteLayerSBOM(lyrs, watchdogLayer, launchMetadata.API(), entry); err != nil {
 		return nil, err
 	}
 
 	return &watchdogLayer, nil
 }
 
-func (l *Contributor) installBinaries(watchdogLayer layers.Layer, version string) error {
+func (l *Contributor) installBinaries(watchdogLayer layers.Layer, api launch.API, conf Config) error {
 	wdMD := &metadata{}
 	if err := watchdogLayer.ReadMetadata(wdMD); err != nil {
 		return errors.New("read metadata: " + err.Error())
 	}
 
 	switch {
-	case wdMD.Version == version:
+	case conf.BinaryPath != "":
+		if err := l.copyWatchdog(conf.BinaryPath, watchdogLayer.Root); err != nil {
+			return errors.New("copying binary: " + err.Error())
+		}
+	case wdMD.Version == conf.Version && wdMD.Config.BinaryPath == "":
 		l.log.Debug("using cache")
 	case wdMD.Version != "":
 		if err := watchdogLayer.RemoveMetadata(); err != nil {
@@ -65,13 +103,15 @@ func (l *Contributor) installBinaries(watchdogLayer layers.Layer, version string
 		}
 		fallthrough
 	default:
-		if err := l.downloadWatchdog(version, watchdogLayer.Root); err != nil {
+		if err := l.downloadWatchdog(conf.Version, watchdogLayer.Root); err != nil {
 			return errors.New("downloading binary: " + err.Error())
 		}
 	}
 
-	wdMD.Version = version
-	if err := watchdogLayer.WriteMetadata(&wdMD, layers.Cache, layers.Launch); err != nil {
+	wdMD.Version = conf.Version
+	wdMD.Profile = conf.Profile
+	wdMD.Config = conf
+	if err := launch.WriteLayerMetadata(watchdogLayer, api, wdMD, layers.Cache, layers.Launch); err != nil {
 		return errors.New("writing metadata: " + err.Error())
 	}
 
@@ -79,33 +119,346 @@ func (l *Contributor) installBinaries(watchdogLayer layers.Layer, version string
 }
 
 // configureApp configures the application
-func (l *Contributor) configureApp(lyrs layers.Layers, watchdogLayer layers.Layer, processType string) error {
-	err := watchdogLayer.DefaultLaunchEnv("function_process", fmt.Sprintf("/cnb/lifecycle/launcher %s", processType))
+func (l *Contributor) configureApp(launchMetadata *launch.Metadata, watchdogLayer layers.Layer, conf Config) error {
+	// env vars from previous builds are removed, as the layer may have been restored from cache
+	if err := os.RemoveAll(filepath.Join(watchdogLayer.Root, "env.launch")); err != nil {
+		return errors.New("removing previous env vars: " + err.Error())
+	}
+
+	var expanded []string
+	for key, value := range conf.Env {
+		if err := watchdogLayer.DefaultLaunchEnv(key, value); err != nil {
+			return fmt.Errorf("writing %s env var: %s", key, err)
+		}
+
+		if hasReferences(value) {
+			if err := walkReferences(value, func(string) {}, func(string, string, bool) error { return nil }); err != nil {
+				return fmt.Errorf("invalid %s env var: %s", key, err)
+			}
+			expanded = append(expanded, key)
+		}
+	}
+
+	// the launcher doesn't expand env vars, so launch-time references are expanded by the function-process helper
+	if len(expanded) > 0 {
+		if !launchMetadata.API().Supports(launch.ExecDAPI) {
+			return fmt.Errorf(
+				"launch-time references in env require buildpack API %s or later, the buildpack declares %s",
+				launch.ExecDAPI, launchMetadata.API(),
+			)
+		}
+
+		sort.Strings(expanded)
+		if err := watchdogLayer.DefaultLaunchEnv(ExpandEnv, strings.Join(expanded, ",")); err != nil {
+			return errors.New("writing " + ExpandEnv + " env var: " + err.Error())
+		}
+	}
+
+	if conf.Mode != "" {
+		if err := watchdogLayer.DefaultLaunchEnv("mode", conf.Mode); err != nil {
+			return errors.New("writing mode env var: " + err.Error())
+		}
+	}
+
+	// static mode serves static_path in place of an upstream process
+	if conf.Mode == StaticMode {
+		if err := watchdogLayer.DefaultLaunchEnv("static_path", conf.StaticPath); err != nil {
+			return errors.New("writing static_path env var: " + err.Error())
+		}
+	} else {
+		err := watchdogLayer.DefaultLaunchEnv("function_process", FunctionProcess(conf.ProcessType))
+		if err != nil {
+			return errors.New("writing function_process env var: " + err.Error())
+		}
+	}
+
+	// launchers from previous builds are removed too
+	if err := os.RemoveAll(filepath.Join(watchdogLayer.Root, functionsDir)); err != nil {
+		return errors.New("removing previous launchers: " + err.Error())
+	}
+
+	// before WorkingDirAPI, the launcher scripts change to the working directory themselves
+	launcherWorkingDir := ""
+	if conf.WorkingDir != "" && !launchMetadata.API().Supports(launch.WorkingDirAPI) {
+		l.log.Debug("buildpack API %s lacks process working directories, launchers change to it", launchMetadata.API())
+		launcherWorkingDir = conf.WorkingDir
+	}
+
+	processes, err := l.functionProcesses(watchdogLayer, conf.Functions, conf.Mode, launcherWorkingDir)
 	if err != nil {
-		return errors.New("writing function_process env var: " + err.Error())
+		return errors.New("writing function launchers: " + err.Error())
 	}
 
-	err = lyrs.WriteApplicationMetadata(layers.Metadata{
-		Processes: []layers.Process{{
-			Type:    "faas",
+	if len(processes) == 0 {
+		process := layers.Process{
+			Type:    processType,
 			Command: filepath.Join(watchdogLayer.Root, executableName),
-			Args:    nil,
-			Direct:  false,
-		}},
-		Slices: nil,
-	})
+		}
+		if launcherWorkingDir != "" {
+			process, err = launcherProcess(watchdogLayer, processType, nil, launcherWorkingDir)
+			if err != nil {
+				return errors.New("writing launcher: " + err.Error())
+			}
+		}
+		processes = append(processes, process)
+
+		// default_process replaces the application's web process, re-declared below, with the watchdog
+		if conf.WebUpstream != "" {
+			process.Type = WebProcessType
+			processes = append(processes, process)
+		}
+	}
+
+	wrappers, err := l.wrapperProcesses(watchdogLayer, conf.Wrap, conf.WebUpstream != "", launcherWorkingDir)
 	if err != nil {
-		return errors.New("writing app metadata file: " + err.Error())
+		return errors.New("writing process wrappers: " + err.Error())
+	}
+	processes = append(processes, wrappers...)
+
+	for _, process := range processes {
+		process.Args = conf.Args
+		process.Direct = conf.Direct == nil || *conf.Direct
+		if err := launchMetadata.AddProcess(contributorName, process); err != nil {
+			return err
+		}
+
+		if conf.WorkingDir != "" && launcherWorkingDir == "" {
+			if err := launchMetadata.SetWorkingDir(process.Type, conf.WorkingDir); err != nil {
+				return err
+			}
+		}
+	}
+
+	if conf.WebUpstream != "" {
+		l.log.Debug("process type '%s' is replaced by the watchdog, and re-declared as '%s'",
+			WebProcessType, WebUpstreamProcessType)
+		upstream := layers.Process{Type: WebUpstreamProcessType, Command: conf.WebUpstream}
+		if err := launchMetadata.AddProcess(contributorName, upstream); err != nil {
+			return err
+		}
+	}
+
+	if err := l.addLabels(launchMetadata, conf); err != nil {
+		return err
+	}
+
+	for _, slice := range conf.Slices {
+		launchMetadata.AddSlice(layers.Slice{Paths: slice.Paths})
+	}
+
+	if isSet(conf.DefaultProcess) {
+		defaultType := processType
+		if conf.WebUpstream != "" {
+			defaultType = WebProcessType
+		}
+
+		if err := launchMetadata.SetDefault(defaultType); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// addLabels adds the configured labels and annotations, which take precedence over the standard labels describing the
+// watchdog, to the image. Annotations are added as labels prefixed with annotationPrefix. Only the configured labels
+// require a buildpack API supporting them.
+func (l *Contributor) addLabels(launchMetadata *launch.Metadata, conf Config) error {
+	if !launchMetadata.API().Supports(launch.LabelsAPI) && len(conf.Labels) == 0 && len(conf.Annotations) == 0 {
+		l.log.Debug("skipping standard labels, unsupported by buildpack API %s", launchMetadata.API())
+		return nil
+	}
+
+	labels := map[string]string{
+		labelPrefix + "watchdog.version": conf.Version,
+	}
+	if conf.Mode != "" {
+		labels[labelPrefix+"watchdog.mode"] = conf.Mode
+	}
+	if version.Version != "" {
+		labels[labelPrefix+"buildpack.version"] = version.Version
+	}
+
+	for key, value := range conf.Annotations {
+		labels[annotationPrefix+key] = value
+	}
+
+	for key, value := range conf.Labels {
+		labels[key] = value
+	}
+
+	for key, value := range labels {
+		if err := launchMetadata.AddLabel(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// functionProcesses writes a launcher script for each function, which exports the function's own settings before
+// starting the watchdog, and returns the matching 'faas-<name>' processes.
+func (l *Contributor) functionProcesses(
+	watchdogLayer layers.Layer,
+	functions []Function,
+	mode string,
+	workingDir string,
+) (layers.Processes, error) {
+	var processes layers.Processes
+	for _, function := range functions {
+		env := map[string]string{}
+		for key, value := range function.Env {
+			env[key] = value
+		}
+		functionMode, ok := env["mode"]
+		if !ok {
+			functionMode = mode
+		}
+		if functionMode != StaticMode {
+			env["function_process"] = FunctionProcess(function.ProcessType)
+		}
+		if function.Port != 0 {
+			env["port"] = strconv.Itoa(function.Port)
+		}
+
+		l.log.Debug("function '%s' will run process type '%s'", function.Name, function.ProcessType)
+		process, err := launcherProcess(watchdogLayer, processType+"-"+function.Name, env, workingDir)
+		if err != nil {
+			return nil, err
+		}
+		processes = append(processes, process)
+	}
+
+	return processes, nil
+}
+
+// wrapperProcesses writes a launcher script for each wrapped process type, which exports its own function_process
+// before starting the watchdog, and returns the matching 'faas-<type>' processes. When webReplaced, a wrapped web
+// process runs the application's web process, re-declared as WebUpstreamProcessType.
+func (l *Contributor) wrapperProcesses(
+	watchdogLayer layers.Layer,
+	wrapped []string,
+	webReplaced bool,
+	workingDir string,
+) (layers.Processes, error) {
+	var processes layers.Processes
+	for _, wrappedType := range wrapped {
+		l.log.Debug("process type '%s' will be wrapped by the watchdog", wrappedType)
+		upstreamType := wrappedType
+		if webReplaced && wrappedType == WebProcessType {
+			upstreamType = WebUpstreamProcessType
+		}
+
+		process, err := launcherProcess(watchdogLayer, processType+"-"+wrappedType, map[string]string{
+			"function_process": FunctionProcess(upstreamType),
+		}, workingDir)
+		if err != nil {
+			return nil, err
+		}
+		processes = append(processes, process)
+	}
+
+	return processes, nil
+}
+
+// launcherProcess writes a launcher script, exporting env and changing to workingDir, when set, before starting the
+// watchdog, for the process type name.
+func launcherProcess(
+	watchdogLayer layers.Layer,
+	name string,
+	env map[string]string,
+	workingDir string,
+) (layers.Process, error) {
+	launchersDir := filepath.Join(watchdogLayer.Root, functionsDir)
+	if err := os.MkdirAll(launchersDir, os.ModePerm); err != nil {
+		return layers.Process{}, err
+	}
+
+	launcher := filepath.Join(launchersDir, name)
+	if err := writeLauncher(launcher, env, workingDir, filepath.Join(watchdogLayer.Root, executableName)); err != nil {
+		return layers.Process{}, err
+	}
+
+	return layers.Process{
+		Type:    name,
+		Command: launcher,
+	}, nil
+}
+
+// FunctionProcess returns the function_process running processType through the CNB launcher.
+func FunctionProcess(processType string) string {
+	return fmt.Sprintf("/cnb/lifecycle/launcher %s", processType)
+}
+
+// writeLauncher writes a shell script that exports env, and changes to workingDir when set, before exec'ing command.
+func writeLauncher(path string, env map[string]string, workingDir string, command string) error {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	script := &strings.Builder{}
+	script.WriteString("#!/usr/bin/env bash\n")
+	for _, key := range keys {
+		if !envNamePattern.MatchString(key) {
+			return fmt.Errorf("invalid env var '%s'", key)
+		}
+
+		value, err := shellValue(env[key])
+		if err != nil {
+			return fmt.Errorf("invalid %s env var: %s", key, err)
+		}
+		fmt.Fprintf(script, "export %s=%s\n", key, value)
+	}
+	if workingDir != "" {
+		fmt.Fprintf(script, "cd %s || exit 1\n", shellQuote(workingDir))
+	}
+	fmt.Fprintf(script, "exec %s \"$@\"\n", shellQuote(command))
+
+	return ioutil.WriteFile(path, []byte(script.String()), 0755)
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// shellValue quotes value for a launcher script, leaving its launch-time references, such as '${PORT}', to be expanded
+// by the shell. As at build time, a reference without a default fails when the variable is unset or empty.
+func shellValue(value string) (string, error) {
+	if !hasReferences(value) {
+		return shellQuote(value), nil
+	}
+
+	word := &strings.Builder{}
+	literal := &strings.Builder{}
+	flush := func() {
+		if literal.Len() > 0 {
+			word.WriteString(shellQuote(literal.String()))
+			literal.Reset()
+		}
+	}
+
+	err := walkReferences(value, func(text string) {
+		literal.WriteString(text)
+	}, func(name string, def string, hasDefault bool) error {
+		flush()
+		if hasDefault {
+			fmt.Fprintf(word, `"${%s:-%s}"`, name, doubleQuoteEscaper.Replace(def))
+		} else {
+			fmt.Fprintf(word, `"${%s:?variable %s is not set}"`, name, name)
+		}
+		return nil
+	})
+	flush()
+
+	return word.String(), err
+}
+
+var doubleQuoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+
 func (l *Contributor) downloadWatchdog(version string, layerDir string) error {
-	downloadUrl := fmt.Sprintf(
-		"https://github.com/openfaas-incubator/of-watchdog/releases/download/%s/of-watchdog",
-		version,
-	)
+	downloadUrl := downloadURL(version)
 	l.log.Debug("downloading from: %s", downloadUrl)
 	resp, err := l.httpClient.Get(downloadUrl)
 	if err != nil {
@@ -119,7 +472,24 @@ func (l *Contributor) downloadWatchdog(version string, layerDir string) error {
 		return fmt.Errorf("downloading from '%s' returned status code '%d'", downloadUrl, resp.StatusCode)
 	}
 
-	err = os.MkdirAll(layerDir, os.ModePerm)
+	return writeWatchdog(resp.Body, layerDir)
+}
+
+func (l *Contributor) copyWatchdog(binaryPath string, layerDir string) error {
+	l.log.Debug("copying from: %s", binaryPath)
+	fh, err := os.Open(binaryPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = fh.Close()
+	}()
+
+	return writeWatchdog(fh, layerDir)
+}
+
+func writeWatchdog(reader io.Reader, layerDir string) error {
+	err := os.MkdirAll(layerDir, os.ModePerm)
 	if err != nil {
 		return errors.New("creating layer dir: " + err.Error())
 	}
@@ -132,9 +502,9 @@ func (l *Contributor) downloadWatchdog(version string, layerDir string) error {
 		_ = watchdogBin.Close()
 	}()
 
-	_, err = io.Copy(watchdogBin, resp.Body)
+	_, err = io.Copy(watchdogBin, reader)
 	if err != nil {
-		return errors.New("downloading watchdog: " + err.Error())
+		return errors.New("writing watchdog: " + err.Error())
 	}
 
 	if err := os.Chmod(watchdogBin.Name(), os.ModePerm); err != nil {
@@ -143,4 +513,3 @@ func (l *Contributor) downloadWatchdog(version string, layerDir string) error {
 
 	return nil
 }
-
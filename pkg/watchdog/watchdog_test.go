@@ -2,20 +2,28 @@ package watchdog_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/BurntSushi/toml"
+	"github.com/buildpacks/libbuildpack/v2/buildpackplan"
+	"github.com/buildpacks/libbuildpack/v2/buildplan"
 	"github.com/buildpacks/libbuildpack/v2/layers"
 	"github.com/buildpacks/libbuildpack/v2/logger"
 	"github.com/gojuno/minimock/v3"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"github.com/jromero/openfaas-cnb/pkg/launch"
+	"github.com/jromero/openfaas-cnb/pkg/shim"
+	"github.com/jromero/openfaas-cnb/pkg/template"
 	"github.com/jromero/openfaas-cnb/pkg/watchdog"
 )
 
@@ -24,6 +32,10 @@ func TestWatchdog(t *testing.T) {
 	RunSpecs(t, "Watchdog")
 }
 
+func flag(value bool) *bool {
+	return &value
+}
+
 var _ = Describe("Watchdog", func() {
 	var (
 		tmpDir string
@@ -51,17 +63,18 @@ process_type = "someType"
 
 [watchdog.env]
 key1 = "value1"
-`))
+`), nil)
 			Expect(err).To(BeNil())
 			Expect(conf).To(Equal(watchdog.Config{
 				Version:     "1.2.3",
 				ProcessType: "someType",
+				Env:         map[string]string{"key1": "value1"},
 			}))
 		})
 
 		Context("version is not set", func() {
 			It("defaults to '0.7.6'", func() {
-				conf, err := watchdog.ParseConfig(strings.NewReader(``))
+				conf, err := watchdog.ParseConfig(strings.NewReader(``), nil)
 				Expect(err).To(BeNil())
 				Expect(conf.Version).To(Equal("0.7.6"))
 			})
@@ -69,16 +82,1291 @@ key1 = "value1"
 
 		Context("process_type is not set", func() {
 			It("defaults to 'web'", func() {
-				conf, err := watchdog.ParseConfig(strings.NewReader(``))
+				conf, err := watchdog.ParseConfig(strings.NewReader(``), nil)
 				Expect(err).To(BeNil())
 				Expect(conf.ProcessType).To(Equal("web"))
 			})
 		})
+
+		Context("process_type is invalid", func() {
+			It("should fail", func() {
+				_, err := watchdog.ParseConfig(strings.NewReader(`
+[watchdog]
+process_type = "some type"
+`), nil)
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring("invalid process_type 'some type'"))
+			})
+		})
+
+		Context("functions are declared", func() {
+			It("parses each function", func() {
+				conf, err := watchdog.ParseConfig(strings.NewReader(`
+[watchdog]
+process_type = "web"
+
+[[watchdog.functions]]
+name = "resize"
+process_type = "resizer"
+port = 8081
+
+[watchdog.functions.env]
+write_timeout = "10s"
+
+[[watchdog.functions]]
+name = "thumbnail"
+`), nil)
+				Expect(err).To(BeNil())
+				Expect(conf.Functions).To(Equal([]watchdog.Function{
+					{Name: "resize", ProcessType: "resizer", Port: 8081, Env: map[string]string{"write_timeout": "10s"}},
+					{Name: "thumbnail", ProcessType: "web"},
+				}))
+			})
+
+			It("rejects duplicate names", func() {
+				_, err := watchdog.ParseConfig(strings.NewReader(`
+[[watchdog.functions]]
+name = "resize"
+
+[[watchdog.functions]]
+name = "resize"
+`), nil)
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring("function 'resize' is declared more than once"))
+			})
+
+			It("parses slices", func() {
+				conf, err := watchdog.ParseConfig(strings.NewReader(`
+[[watchdog.slices]]
+paths = ["function/**"]
+
+[[watchdog.slices]]
+paths = ["vendor/**", "go.sum"]
+`), nil)
+				Expect(err).To(BeNil())
+				Expect(conf.Slices).To(Equal([]watchdog.Slice{
+					{Paths: []string{"function/**"}},
+					{Paths: []string{"vendor/**", "go.sum"}},
+				}))
+			})
+
+			It("rejects slice paths outside the application", func() {
+				_, err := watchdog.ParseConfig(strings.NewReader(`
+[[watchdog.slices]]
+paths = ["../shared/**"]
+`), nil)
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(Equal("invalid slice path '../shared/**': must be relative to the application"))
+			})
+
+			It("rejects empty slices", func() {
+				_, err := watchdog.ParseConfig(strings.NewReader(`
+[[watchdog.slices]]
+paths = []
+`), nil)
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(Equal("slice 0 has no paths"))
+			})
+
+			It("parses the watchdog process options", func() {
+				conf, err := watchdog.ParseConfig(strings.NewReader(`
+[watchdog]
+direct = false
+args = ["--flag", "value"]
+working_dir = "function"
+`), nil)
+				Expect(err).To(BeNil())
+				Expect(*conf.Direct).To(BeFalse())
+				Expect(conf.Args).To(Equal([]string{"--flag", "value"}))
+				Expect(conf.WorkingDir).To(Equal("function"))
+			})
+
+			It("parses secrets", func() {
+				conf, err := watchdog.ParseConfig(strings.NewReader(`
+[watchdog]
+optional_secrets = ["api-key"]
+
+[watchdog.secrets]
+db-password = "DATABASE_PASSWORD"
+api-key = "API_KEY"
+`), nil)
+				Expect(err).To(BeNil())
+				Expect(conf.Secrets).To(Equal(map[string]string{"db-password": "DATABASE_PASSWORD", "api-key": "API_KEY"}))
+				Expect(conf.OptionalSecrets).To(Equal([]string{"api-key"}))
+			})
+
+			It("rejects launch-time references outside env", func() {
+				_, err := watchdog.ParseConfig(strings.NewReader(`
+[watchdog]
+args = ["--port", "$${PORT}"]
+`), nil)
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(Equal("invalid args[1] '${PORT}': launch-time references are only expanded in env"))
+
+				_, err = watchdog.ParseConfig(strings.NewReader(`
+[watchdog]
+working_dir = "$${HOME}/function"
+`), nil)
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(HavePrefix("invalid working_dir '${HOME}/function'"))
+			})
+
+			It("rejects empty or invalid env var names", func() {
+				for _, key := range []string{`""`, `"exec-timeout"`} {
+					_, err := watchdog.ParseConfig(strings.NewReader(`
+[watchdog.env]
+`+key+` = "10s"
+`), nil)
+					Expect(err).ToNot(BeNil())
+					Expect(err.Error()).To(HavePrefix("invalid env var "))
+				}
+			})
+
+			It("rejects secrets exported as invalid environment variables", func() {
+				_, err := watchdog.ParseConfig(strings.NewReader(`
+[watchdog.secrets]
+db-password = "DATABASE-PASSWORD"
+`), nil)
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(Equal("invalid environment variable 'DATABASE-PASSWORD' for secret 'db-password'"))
+			})
+
+			It("rejects secrets exported as the same environment variable", func() {
+				_, err := watchdog.ParseConfig(strings.NewReader(`
+[watchdog.secrets]
+db-password = "PASSWORD"
+smtp-password = "PASSWORD"
+`), nil)
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(Equal("secrets 'db-password' and 'smtp-password' are both exported as PASSWORD"))
+			})
+
+			It("rejects undeclared optional secrets", func() {
+				_, err := watchdog.ParseConfig(strings.NewReader(`
+[watchdog]
+optional_secrets = ["api-key"]
+`), nil)
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(Equal("optional secret 'api-key' is not declared in secrets"))
+			})
+
+			It("requires static_path in static mode", func() {
+				_, err := watchdog.ParseConfig(strings.NewReader(`
+[watchdog]
+mode = "static"
+`), nil)
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(Equal("mode 'static' requires static_path"))
+			})
+
+			It("rejects static_path in other modes", func() {
+				_, err := watchdog.ParseConfig(strings.NewReader(`
+[watchdog]
+mode = "http"
+static_path = "public"
+`), nil)
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(Equal("static_path requires mode 'static'"))
+			})
+
+			It("rejects wrap alongside wrap_all", func() {
+				_, err := watchdog.ParseConfig(strings.NewReader(`
+[watchdog]
+wrap = ["web"]
+wrap_all = true
+`), nil)
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(Equal("only one of wrap or wrap_all may be set"))
+			})
+
+			It("rejects default_process", func() {
+				_, err := watchdog.ParseConfig(strings.NewReader(`
+[watchdog]
+default_process = true
+
+[[watchdog.functions]]
+name = "resize"
+`), nil)
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(Equal("default_process may not be set when functions are declared"))
+			})
+
+			It("rejects env vars that can't be exported", func() {
+				for _, key := range []string{`"my-var"`, `"b; touch /tmp/pwned #"`} {
+					_, err := watchdog.ParseConfig(strings.NewReader(`
+[[watchdog.functions]]
+name = "resize"
+
+[watchdog.functions.env]
+`+key+` = "value"
+`), nil)
+					Expect(err).ToNot(BeNil())
+					Expect(err.Error()).To(HavePrefix("invalid env var for function 'resize'"))
+				}
+			})
+		})
+		Context("values reference variables", func() {
+			It("interpolates them from the env", func() {
+				conf, err := watchdog.ParseConfig(strings.NewReader(`
+[watchdog]
+version = "${WATCHDOG_VERSION:-0.8.0}"
+process_type = "${PROCESS_TYPE:-web}"
+
+[watchdog.env]
+upstream_url = "http://127.0.0.1:$${PORT}"
+exec_timeout = "${TIMEOUT}"
+`), map[string]string{"WATCHDOG_VERSION": "0.8.1", "TIMEOUT": "10s"})
+				Expect(err).To(BeNil())
+				Expect(conf.Version).To(Equal("0.8.1"))
+				Expect(conf.ProcessType).To(Equal("web"))
+				Expect(conf.Env).To(Equal(map[string]string{
+					"upstream_url": "http://127.0.0.1:${PORT}",
+					"exec_timeout": "10s",
+				}))
+			})
+
+			It("fails when a variable without a default is not set", func() {
+				_, err := watchdog.ParseConfig(strings.NewReader(`
+[[watchdog.functions]]
+name = "resize"
+
+[watchdog.functions.env]
+exec_timeout = "${TIMEOUT}"
+`), nil)
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(Equal("interpolating 'watchdog.functions[0].env.exec_timeout': variable 'TIMEOUT' is not set"))
+			})
+		})
+	})
+
+	Describe("ParseProjectConfig", func() {
+		It("parses a [metadata.openfaas.watchdog] table", func() {
+			conf, err := watchdog.ParseProjectConfig(strings.NewReader(`
+[project]
+id = "some-app"
+
+[metadata.openfaas.watchdog]
+version = "1.2.3"
+process_type = "someType"
+`), nil)
+			Expect(err).To(BeNil())
+			Expect(conf).To(Equal(watchdog.Config{
+				Version:     "1.2.3",
+				ProcessType: "someType",
+			}))
+		})
+
+		It("parses a [io.buildpacks.openfaas] table", func() {
+			conf, err := watchdog.ParseProjectConfig(strings.NewReader(`
+[[io.buildpacks.group]]
+uri = "some-buildpack"
+
+[io.buildpacks.openfaas]
+version = "1.2.3"
+`), nil)
+			Expect(err).To(BeNil())
+			Expect(conf).To(Equal(watchdog.Config{
+				Version:     "1.2.3",
+				ProcessType: "web",
+			}))
+		})
+
+		Context("both tables are declared", func() {
+			It("should fail", func() {
+				_, err := watchdog.ParseProjectConfig(strings.NewReader(`
+[metadata.openfaas.watchdog]
+version = "1.2.3"
+
+[io.buildpacks.openfaas]
+version = "1.2.4"
+`), nil)
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring("only one of"))
+			})
+		})
+
+		Context("no watchdog table is declared", func() {
+			It("returns the defaults", func() {
+				conf, err := watchdog.ParseProjectConfig(strings.NewReader(`
+[project]
+id = "some-app"
+`), nil)
+				Expect(err).To(BeNil())
+				Expect(conf).To(Equal(watchdog.DefaultConfig()))
+			})
+		})
+	})
+
+	Describe("LoadConfig", func() {
+		var appDir string
+
+		BeforeEach(func() {
+			var err error
+			appDir, err = ioutil.TempDir(tmpDir, "app")
+			Expect(err).To(BeNil())
+		})
+
+		writeFile := func(name, contents string) {
+			Expect(os.MkdirAll(filepath.Dir(filepath.Join(appDir, name)), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(appDir, name), []byte(contents), 0644)).To(Succeed())
+		}
+
+		loadConfig := func() (watchdog.Config, error) {
+			sources, err := watchdog.ConfigPaths(appDir, "")
+			Expect(err).To(BeNil())
+			return watchdog.LoadConfig(sources, "", nil)
+		}
+
+		Context("no config files exist", func() {
+			It("returns the defaults", func() {
+				conf, err := loadConfig()
+				Expect(err).To(BeNil())
+				Expect(conf.Version).To(Equal(watchdog.DefaultConfig().Version))
+				Expect(conf.ProcessType).To(Equal(watchdog.DefaultConfig().ProcessType))
+				Expect(conf.Origins).To(Equal(watchdog.Origins{
+					"version":      "default",
+					"process_type": "default",
+				}))
+			})
+		})
+
+		Context("only project.toml exists", func() {
+			It("uses project.toml", func() {
+				writeFile("project.toml", `
+[metadata.openfaas.watchdog]
+process_type = "worker"
+`)
+
+				conf, err := loadConfig()
+				Expect(err).To(BeNil())
+				Expect(conf.ProcessType).To(Equal("worker"))
+				Expect(conf.Version).To(Equal("0.7.6"))
+			})
+		})
+
+		Context("stack.yml exists", func() {
+			It("uses the labels and annotations of the application's function", func() {
+				writeFile("stack.yml", `
+version: 1.0
+provider:
+  name: openfaas
+functions:
+  resize:
+    lang: golang-http
+    handler: ./resize
+    labels:
+      com.openfaas.scale.min: "5"
+  app:
+    lang: golang-http
+    handler: ./
+    labels:
+      com.openfaas.scale.min: "2"
+      team: images
+    annotations:
+      topic: uploads
+`)
+				writeFile("watchdog.toml", `
+[watchdog.labels]
+team = "media"
+`)
+
+				conf, err := loadConfig()
+				Expect(err).To(BeNil())
+				Expect(conf.Labels).To(Equal(map[string]string{
+					"com.openfaas.scale.min": "2",
+					"team":                   "media",
+				}))
+				Expect(conf.Annotations).To(Equal(map[string]string{"topic": "uploads"}))
+			})
+
+			It("ignores a stack.yml without the application's function", func() {
+				writeFile("stack.yml", `
+functions:
+  resize:
+    handler: ./resize
+    labels:
+      team: images
+  thumbnail:
+    handler: ./thumbnail
+`)
+
+				conf, err := loadConfig()
+				Expect(err).To(BeNil())
+				Expect(conf.Labels).To(BeEmpty())
+			})
+		})
+
+		Context("both watchdog.toml and project.toml exist", func() {
+			It("gives precedence to watchdog.toml", func() {
+				writeFile("project.toml", `
+[metadata.openfaas.watchdog]
+version = "1.2.3"
+process_type = "worker"
+`)
+				writeFile("watchdog.toml", `
+[watchdog]
+version = "2.0.0"
+`)
+
+				conf, err := loadConfig()
+				Expect(err).To(BeNil())
+				Expect(conf.Version).To(Equal("2.0.0"))
+				Expect(conf.ProcessType).To(Equal("worker"))
+			})
+
+			It("lets watchdog.toml turn off default_process", func() {
+				writeFile("project.toml", `
+[metadata.openfaas.watchdog]
+default_process = true
+`)
+				writeFile("watchdog.toml", `
+[watchdog]
+default_process = false
+`)
+
+				conf, err := loadConfig()
+				Expect(err).To(BeNil())
+				Expect(*conf.DefaultProcess).To(BeFalse())
+			})
+		})
+
+		Context("watchdog.toml exists in .openfaas", func() {
+			It("uses .openfaas/watchdog.toml", func() {
+				writeFile(filepath.Join(".openfaas", "watchdog.toml"), `
+[watchdog]
+process_type = "worker"
+`)
+
+				conf, err := loadConfig()
+				Expect(err).To(BeNil())
+				Expect(conf.ProcessType).To(Equal("worker"))
+			})
+		})
+
+		Context("a config path is provided", func() {
+			BeforeEach(func() {
+				writeFile("watchdog.toml", `
+[watchdog]
+process_type = "root"
+`)
+				writeFile(filepath.Join("functions", "resize", "watchdog.toml"), `
+[watchdog]
+process_type = "resize"
+binary_path = "bin/of-watchdog"
+`)
+			})
+
+			It("uses the provided config instead of the search paths", func() {
+				sources, err := watchdog.ConfigPaths(appDir, filepath.Join("functions", "resize", "watchdog.toml"))
+				Expect(err).To(BeNil())
+
+				conf, err := watchdog.LoadConfig(sources, "", nil)
+				Expect(err).To(BeNil())
+				Expect(conf.ProcessType).To(Equal("resize"))
+			})
+
+			It("resolves paths relative to the config file", func() {
+				sources, err := watchdog.ConfigPaths(appDir, filepath.Join("functions", "resize", "watchdog.toml"))
+				Expect(err).To(BeNil())
+
+				conf, err := watchdog.LoadConfig(sources, "", nil)
+				Expect(err).To(BeNil())
+				Expect(conf.BinaryPath).To(Equal(filepath.Join(appDir, "functions", "resize", "bin", "of-watchdog")))
+			})
+
+			It("fails when the config doesn't exist", func() {
+				_, err := watchdog.ConfigPaths(appDir, "missing.toml")
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring("config file '" + filepath.Join(appDir, "missing.toml") + "' does not exist"))
+			})
+		})
+
+		Context("a profile is selected", func() {
+			BeforeEach(func() {
+				writeFile("watchdog.toml", `
+[watchdog]
+version = "1.2.3"
+
+[watchdog.env]
+exec_timeout = "10s"
+write_timeout = "10s"
+
+[watchdog.profiles.prod]
+version = "2.0.0"
+
+[watchdog.profiles.prod.env]
+exec_timeout = "60s"
+
+[watchdog.profiles.dev]
+process_type = "dev"
+`)
+			})
+
+			It("overlays the profile onto the base config", func() {
+				sources, err := watchdog.ConfigPaths(appDir, "")
+				Expect(err).To(BeNil())
+
+				conf, err := watchdog.LoadConfig(sources, "prod", nil)
+				Expect(err).To(BeNil())
+				Expect(conf).To(Equal(watchdog.Config{
+					Version:     "2.0.0",
+					ProcessType: "web",
+					Env: map[string]string{
+						"exec_timeout":  "60s",
+						"write_timeout": "10s",
+					},
+					Profile: "prod",
+					Origins: watchdog.Origins{
+						"version":           "watchdog.toml (profile 'prod')",
+						"process_type":      "default",
+						"env.exec_timeout":  "watchdog.toml (profile 'prod')",
+						"env.write_timeout": "watchdog.toml",
+						"profiles.prod":     "watchdog.toml",
+						"profiles.dev":      "watchdog.toml",
+					},
+				}))
+			})
+
+			It("turns off default_process set by the base config", func() {
+				writeFile("watchdog.toml", `
+[watchdog]
+default_process = true
+
+[watchdog.profiles.dev]
+default_process = false
+`)
+				sources, err := watchdog.ConfigPaths(appDir, "")
+				Expect(err).To(BeNil())
+
+				conf, err := watchdog.LoadConfig(sources, "dev", nil)
+				Expect(err).To(BeNil())
+				Expect(*conf.DefaultProcess).To(BeFalse())
+				Expect(conf.Origins["default_process"]).To(Equal("watchdog.toml (profile 'dev')"))
+			})
+
+			It("turns off wrap_all set by the base config", func() {
+				writeFile("watchdog.toml", `
+[watchdog]
+wrap_all = true
+
+[watchdog.profiles.dev]
+wrap_all = false
+`)
+				sources, err := watchdog.ConfigPaths(appDir, "")
+				Expect(err).To(BeNil())
+
+				conf, err := watchdog.LoadConfig(sources, "dev", nil)
+				Expect(err).To(BeNil())
+				Expect(*conf.WrapAll).To(BeFalse())
+				Expect(conf.Origins["wrap_all"]).To(Equal("watchdog.toml (profile 'dev')"))
+			})
+
+			It("fails when the profile doesn't exist", func() {
+				sources, err := watchdog.ConfigPaths(appDir, "")
+				Expect(err).To(BeNil())
+
+				_, err = watchdog.LoadConfig(sources, "staging", nil)
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(Equal("profile 'staging' not found, available profiles: [dev, prod]"))
+			})
+		})
+
+		Context("checking whether a watchdog config is declared", func() {
+			declared := func() bool {
+				sources, err := watchdog.ConfigPaths(appDir, "")
+				Expect(err).To(BeNil())
+
+				declared, err := watchdog.Declared(sources)
+				Expect(err).To(BeNil())
+				return declared
+			}
+
+			It("is declared by watchdog.toml", func() {
+				writeFile("watchdog.toml", ``)
+				Expect(declared()).To(BeTrue())
+			})
+
+			It("is declared by a project.toml watchdog table", func() {
+				writeFile("project.toml", `
+[io.buildpacks.openfaas]
+version = "0.8.0"
+`)
+				Expect(declared()).To(BeTrue())
+			})
+
+			It("is not declared by a project.toml without a watchdog table", func() {
+				writeFile("project.toml", `
+[project]
+id = "some-app"
+`)
+				Expect(declared()).To(BeFalse())
+			})
+		})
+
+		Context("a config file is invalid", func() {
+			It("reports the offending file", func() {
+				writeFile("project.toml", `[metadata.openfaas.watchdog`)
+
+				_, err := loadConfig()
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring(filepath.Join(appDir, "project.toml")))
+			})
+		})
+
+		Context("platform env variables are set", func() {
+			loadConfigWithEnv := func(env map[string]string) watchdog.Config {
+				writeFile("watchdog.toml", `
+[watchdog]
+version = "0.7.9"
+process_type = "worker"
+binary_path = "bin/of-watchdog"
+`)
+				sources, err := watchdog.ConfigPaths(appDir, "")
+				Expect(err).To(BeNil())
+				conf, err := watchdog.LoadConfig(sources, "", env)
+				Expect(err).To(BeNil())
+				return conf
+			}
+
+			It("overrides the version with BP_WATCHDOG_VERSION", func() {
+				conf := loadConfigWithEnv(map[string]string{"BP_WATCHDOG_VERSION": "0.8.0"})
+				Expect(conf.Version).To(Equal("0.8.0"))
+				Expect(conf.Origins["version"]).To(Equal(watchdog.OriginPlatformEnv))
+				Expect(conf.ProcessType).To(Equal("worker"))
+			})
+
+			It("overrides the process type with BP_WATCHDOG_PROCESS_TYPE", func() {
+				conf := loadConfigWithEnv(map[string]string{"BP_WATCHDOG_PROCESS_TYPE": "web"})
+				Expect(conf.ProcessType).To(Equal("web"))
+				Expect(conf.Origins["process_type"]).To(Equal(watchdog.OriginPlatformEnv))
+				Expect(conf.Version).To(Equal("0.7.9"))
+			})
+
+			It("ignores variables for other keys", func() {
+				conf := loadConfigWithEnv(map[string]string{
+					"BP_WATCHDOG_BINARY_PATH": "bin/other",
+					"BP_WATCHDOG_MODE":        "static",
+				})
+				Expect(conf.BinaryPath).To(Equal(filepath.Join(appDir, "bin", "of-watchdog")))
+				Expect(conf.Origins["binary_path"]).To(Equal("watchdog.toml"))
+				Expect(conf.Mode).ToNot(Equal("static"))
+			})
+		})
+	})
+
+	Describe("ResolvePlan", func() {
+		entry := func(version string) buildpackplan.Plan {
+			return buildpackplan.Plan{
+				Name:     "openfaas-watchdog",
+				Metadata: buildpackplan.Metadata{"version": version},
+			}
+		}
+
+		Context("the version is defaulted", func() {
+			var conf watchdog.Config
+
+			BeforeEach(func() {
+				var err error
+				conf, err = watchdog.LoadConfig(nil, "", nil)
+				Expect(err).To(BeNil())
+			})
+
+			It("uses an exact version required by the build plan", func() {
+				resolved, planEntry, err := watchdog.ResolvePlan(conf, []buildpackplan.Plan{entry("0.7.*"), entry("0.7.9")})
+				Expect(err).To(BeNil())
+				Expect(resolved.Version).To(Equal("0.7.9"))
+				Expect(resolved.Origins["version"]).To(Equal("build plan"))
+				Expect(planEntry).To(Equal(buildpackplan.Plan{
+					Name:     "openfaas-watchdog",
+					Version:  "0.7.9",
+					Metadata: buildpackplan.Metadata{"version": "0.7.9"},
+				}))
+			})
+
+			It("uses the default when it satisfies the constraints", func() {
+				resolved, _, err := watchdog.ResolvePlan(conf, []buildpackplan.Plan{entry("0.x"), {Name: "other", Version: "1.0.0"}})
+				Expect(err).To(BeNil())
+				Expect(resolved.Version).To(Equal("0.7.6"))
+			})
+		})
+
+		It("uses the template recognised during detection", func() {
+			conf := watchdog.Config{Version: "0.7.6"}
+			resolved, planEntry, err := watchdog.ResolvePlan(conf, []buildpackplan.Plan{{
+				Name:     "openfaas-watchdog",
+				Metadata: buildpackplan.Metadata{"template": "python3"},
+			}})
+			Expect(err).To(BeNil())
+			Expect(resolved.Template).To(Equal("python3"))
+			Expect(planEntry.Metadata["template"]).To(Equal("python3"))
+		})
+
+		Context("the version is configured", func() {
+			conf := watchdog.Config{Version: "0.8.0", Origins: watchdog.Origins{"version": "watchdog.toml"}}
+
+			It("fails when it doesn't satisfy a constraint", func() {
+				_, _, err := watchdog.ResolvePlan(conf, []buildpackplan.Plan{entry("0.7.*")})
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(Equal("watchdog version '0.8.0' (watchdog.toml) does not satisfy constraint '0.7.*' required by the build plan"))
+			})
+
+			It("is used over an exact version required by the build plan", func() {
+				_, _, err := watchdog.ResolvePlan(conf, []buildpackplan.Plan{entry("0.7.9")})
+				Expect(err).ToNot(BeNil())
+			})
+
+			It("satisfies matching constraints", func() {
+				resolved, _, err := watchdog.ResolvePlan(conf, []buildpackplan.Plan{entry("0.8.x"), entry("*"), entry("0.8.0")})
+				Expect(err).To(BeNil())
+				Expect(resolved.Version).To(Equal("0.8.0"))
+			})
+		})
+	})
+
+	Describe("Detect", func() {
+		var appDir string
+
+		BeforeEach(func() {
+			var err error
+			appDir, err = ioutil.TempDir(tmpDir, "app")
+			Expect(err).To(BeNil())
+		})
+
+		writeFile := func(name, contents string) {
+			Expect(ioutil.WriteFile(filepath.Join(appDir, name), []byte(contents), 0644)).To(Succeed())
+		}
+
+		plan := func(metadata buildplan.Metadata) buildplan.Plan {
+			return buildplan.Plan{
+				Provides: []buildplan.Provided{{Name: watchdog.PlanEntryName}},
+				Requires: []buildplan.Required{{Name: watchdog.PlanEntryName, Metadata: metadata}},
+			}
+		}
+
+		It("fails without a watchdog config or a function layout", func() {
+			detection, err := watchdog.Detect(appDir, map[string]string{})
+			Expect(err).To(BeNil())
+			Expect(detection.Passed()).To(BeFalse())
+			Expect(detection.Reason).To(Equal("no watchdog config or function layout found"))
+		})
+
+		It("passes when a watchdog config is declared", func() {
+			writeFile("watchdog.toml", "[watchdog]\nprocess_type = \"worker\"\n")
+
+			detection, err := watchdog.Detect(appDir, map[string]string{})
+			Expect(err).To(BeNil())
+			Expect(detection.Plans).To(Equal([]buildplan.Plan{plan(buildplan.Metadata{})}))
+		})
+
+		Context("BP_OPENFAAS_ENABLED is set", func() {
+			It("passes without a watchdog config or a function layout when true", func() {
+				detection, err := watchdog.Detect(appDir, map[string]string{watchdog.EnabledEnv: "true"})
+				Expect(err).To(BeNil())
+				Expect(detection.Plans).To(Equal([]buildplan.Plan{plan(buildplan.Metadata{})}))
+			})
+
+			It("fails despite a watchdog config when false", func() {
+				writeFile("watchdog.toml", "[watchdog]\nprocess_type = \"worker\"\n")
+
+				detection, err := watchdog.Detect(appDir, map[string]string{watchdog.EnabledEnv: "false"})
+				Expect(err).To(BeNil())
+				Expect(detection.Passed()).To(BeFalse())
+				Expect(detection.Reason).To(Equal("BP_OPENFAAS_ENABLED is false"))
+			})
+
+			It("fails with a config error when invalid", func() {
+				_, err := watchdog.Detect(appDir, map[string]string{watchdog.EnabledEnv: "maybe"})
+				Expect(err).To(BeAssignableToTypeOf(watchdog.ConfigError{}))
+				Expect(err.Error()).To(Equal("invalid BP_OPENFAAS_ENABLED 'maybe'"))
+			})
+		})
+
+		Context("the version", func() {
+			It("is required when configured", func() {
+				writeFile("watchdog.toml", "[watchdog]\nversion = \"0.7.9\"\n")
+
+				detection, err := watchdog.Detect(appDir, map[string]string{})
+				Expect(err).To(BeNil())
+				Expect(detection.Plans).To(Equal([]buildplan.Plan{plan(buildplan.Metadata{"version": "0.7.9"})}))
+			})
+
+			It("is required when overridden by the platform env", func() {
+				detection, err := watchdog.Detect(appDir, map[string]string{
+					watchdog.EnabledEnv:   "true",
+					"BP_WATCHDOG_VERSION": "0.8.0",
+				})
+				Expect(err).To(BeNil())
+				Expect(detection.Plans).To(Equal([]buildplan.Plan{plan(buildplan.Metadata{"version": "0.8.0"})}))
+			})
+		})
+
+		Context("a function template is recognised", func() {
+			BeforeEach(func() {
+				writeFile("handler.py", "def handle(req):\n    return req\n")
+				writeFile("requirements.txt", "")
+			})
+
+			It("prefers the plan requiring the template's language, falling back to the plain plan", func() {
+				detection, err := watchdog.Detect(appDir, map[string]string{})
+				Expect(err).To(BeNil())
+				Expect(detection.Template).To(Equal("python3"))
+
+				metadata := buildplan.Metadata{"template": "python3"}
+				withLanguage := plan(metadata)
+				withLanguage.Requires = append([]buildplan.Required{{Name: "python"}}, withLanguage.Requires...)
+				Expect(detection.Plans).To(Equal([]buildplan.Plan{withLanguage, plan(metadata)}))
+			})
+
+			It("uses the configured template over the layout", func() {
+				writeFile("watchdog.toml", "[watchdog]\ntemplate = \"node\"\n")
+
+				detection, err := watchdog.Detect(appDir, map[string]string{})
+				Expect(err).To(BeNil())
+				Expect(detection.Template).To(Equal("node"))
+				Expect(detection.Plans[0].Requires[0]).To(Equal(buildplan.Required{Name: "node"}))
+			})
+		})
+
+		It("fails with a config error when the configured template is unknown", func() {
+			writeFile("watchdog.toml", "[watchdog]\ntemplate = \"cobol\"\n")
+
+			_, err := watchdog.Detect(appDir, map[string]string{})
+			Expect(err).To(BeAssignableToTypeOf(watchdog.ConfigError{}))
+			Expect(err.Error()).To(Equal("unknown template 'cobol'"))
+		})
+
+		It("fails with a config error when a config file is invalid", func() {
+			writeFile("watchdog.toml", "[watchdog")
+
+			_, err := watchdog.Detect(appDir, map[string]string{})
+			Expect(err).To(BeAssignableToTypeOf(watchdog.ConfigError{}))
+		})
+	})
+
+	Describe("ProcessTypes", func() {
+		var appDir string
+
+		BeforeEach(func() {
+			var err error
+			appDir, err = ioutil.TempDir(tmpDir, "app")
+			Expect(err).To(BeNil())
+		})
+
+		writeFile := func(name string, contents string) {
+			Expect(ioutil.WriteFile(filepath.Join(appDir, name), []byte(contents), 0644)).To(Succeed())
+		}
+
+		It("returns no process types when none are defined", func() {
+			types, err := watchdog.ProcessTypes(appDir)
+			Expect(err).To(BeNil())
+			Expect(types).To(BeEmpty())
+		})
+
+		It("reads the commands of the Procfile and project.toml process definitions", func() {
+			writeFile("Procfile", "web: ruby ./app.rb\nworker:  ruby ./worker.rb\n")
+			writeFile("project.toml", `
+[[io.buildpacks.processes]]
+type = "web"
+command = "ruby ./server.rb"
+`)
+
+			commands, err := watchdog.ProcessCommands(appDir)
+			Expect(err).To(BeNil())
+			Expect(commands).To(Equal(map[string]string{"web": "ruby ./server.rb", "worker": "ruby ./worker.rb"}))
+		})
+
+		It("reads the Procfile and project.toml process definitions", func() {
+			writeFile("Procfile", "web: ruby ./app.rb\n\n# background jobs\nworker: ruby ./worker.rb\n")
+			writeFile("project.toml", `
+[[io.buildpacks.processes]]
+type = "migrate"
+command = "ruby ./migrate.rb"
+
+[[io.buildpacks.processes]]
+type = "web"
+command = "ruby ./app.rb"
+`)
+
+			types, err := watchdog.ProcessTypes(appDir)
+			Expect(err).To(BeNil())
+			Expect(types).To(Equal([]string{"migrate", "web", "worker"}))
+		})
+
+		It("fails on an invalid Procfile", func() {
+			writeFile("Procfile", "ruby ./app.rb\n")
+
+			_, err := watchdog.ProcessTypes(appDir)
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(Equal("reading 'Procfile': invalid process definition 'ruby ./app.rb'"))
+		})
+	})
+
+	Describe("ApplyTemplate", func() {
+		It("uses the template's default slices", func() {
+			tmpl, err := template.Lookup("golang-http")
+			Expect(err).To(BeNil())
+
+			conf := watchdog.ApplyTemplate(watchdog.Config{Origins: watchdog.Origins{}}, tmpl)
+			Expect(conf.Slices).To(Equal([]watchdog.Slice{
+				{Paths: []string{"vendor/**"}},
+				{Paths: []string{"function/**"}},
+			}))
+			Expect(conf.Origins["slices"]).To(Equal("template 'golang-http'"))
+		})
+
+		It("keeps configured slices", func() {
+			tmpl, err := template.Lookup("golang-http")
+			Expect(err).To(BeNil())
+
+			slices := []watchdog.Slice{{Paths: []string{"static/**"}}}
+			conf := watchdog.ApplyTemplate(watchdog.Config{Slices: slices}, tmpl)
+			Expect(conf.Slices).To(Equal(slices))
+		})
+	})
+
+	Describe("ApplyShim", func() {
+		var conf watchdog.Config
+
+		BeforeEach(func() {
+			conf = watchdog.Config{
+				ProcessType: "web",
+				Origins:     watchdog.Origins{"process_type": watchdog.OriginDefault},
+			}
+		})
+
+		goShim := func() shim.Shim {
+			tmpl, err := template.Lookup("golang-middleware")
+			Expect(err).To(BeNil())
+
+			return shim.Shim{
+				Template:    tmpl,
+				Build:       true,
+				Mode:        "http",
+				Env:         map[string]string{"upstream_url": "http://127.0.0.1:8082"},
+				ProcessType: "web",
+			}
+		}
+
+		It("sets the shim's mode, env and process type", func() {
+			conf, err := watchdog.ApplyShim(conf, goShim())
+			Expect(err).To(BeNil())
+			Expect(conf.Mode).To(Equal("http"))
+			Expect(conf.Env).To(Equal(map[string]string{"upstream_url": "http://127.0.0.1:8082"}))
+			Expect(conf.ProcessType).To(Equal("web"))
+			Expect(conf.Origins["process_type"]).To(Equal("template 'golang-middleware'"))
+		})
+
+		It("keeps a configured process type", func() {
+			conf.ProcessType = "worker"
+			conf.Origins["process_type"] = "watchdog.toml"
+
+			conf, err := watchdog.ApplyShim(conf, goShim())
+			Expect(err).To(BeNil())
+			Expect(conf.ProcessType).To(Equal("worker"))
+		})
+
+		It("fails when default_process is set for a built shim", func() {
+			conf.DefaultProcess = flag(true)
+
+			_, err := watchdog.ApplyShim(conf, goShim())
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("default_process is not supported with the generated 'golang-middleware' entrypoint"))
+		})
+	})
+
+	Describe("ResolveStaticPath", func() {
+		var (
+			appDir string
+			conf   watchdog.Config
+		)
+
+		BeforeEach(func() {
+			var err error
+			appDir, err = ioutil.TempDir(tmpDir, "app")
+			Expect(err).To(BeNil())
+
+			conf = watchdog.Config{
+				ProcessType: "web",
+				Mode:        "static",
+				StaticPath:  "public",
+				Origins:     watchdog.Origins{"static_path": "watchdog.toml"},
+			}
+		})
+
+		It("resolves static_path relative to the application", func() {
+			Expect(os.Mkdir(filepath.Join(appDir, "public"), os.ModePerm)).To(Succeed())
+
+			resolved, err := watchdog.ResolveStaticPath(conf, appDir)
+			Expect(err).To(BeNil())
+			Expect(resolved.StaticPath).To(Equal(filepath.Join(appDir, "public")))
+		})
+
+		It("fails when static_path doesn't exist", func() {
+			_, err := watchdog.ResolveStaticPath(conf, appDir)
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(Equal("static_path 'public' (watchdog.toml) does not exist"))
+		})
+
+		It("fails when static_path isn't a directory", func() {
+			Expect(ioutil.WriteFile(filepath.Join(appDir, "public"), nil, 0644)).To(Succeed())
+
+			_, err := watchdog.ResolveStaticPath(conf, appDir)
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(Equal("static_path 'public' (watchdog.toml) is not a directory"))
+		})
+
+		It("fails when static_path is absolute", func() {
+			conf.StaticPath = filepath.Join(appDir, "public")
+			Expect(os.Mkdir(conf.StaticPath, os.ModePerm)).To(Succeed())
+
+			_, err := watchdog.ResolveStaticPath(conf, appDir)
+			Expect(err).To(BeAssignableToTypeOf(watchdog.ConfigError{}))
+			Expect(err.Error()).To(Equal(fmt.Sprintf(
+				"static_path '%s' (watchdog.toml) must be relative to the application, and within it", conf.StaticPath,
+			)))
+		})
+
+		It("fails when static_path is outside the application", func() {
+			for _, path := range []string{"..", "../public", "public/../../public"} {
+				conf.StaticPath = path
+
+				_, err := watchdog.ResolveStaticPath(conf, appDir)
+				Expect(err).To(BeAssignableToTypeOf(watchdog.ConfigError{}))
+				Expect(err.Error()).To(Equal(fmt.Sprintf(
+					"static_path '%s' (watchdog.toml) must be relative to the application, and within it", path,
+				)))
+			}
+		})
+	})
+
+	Describe("ResolveDirect", func() {
+		var appDir string
+
+		BeforeEach(func() {
+			var err error
+			appDir, err = ioutil.TempDir(tmpDir, "app")
+			Expect(err).To(BeNil())
+		})
+
+		It("execs the watchdog directly by default", func() {
+			resolved, err := watchdog.ResolveDirect(watchdog.Config{Origins: watchdog.Origins{}}, appDir)
+			Expect(err).To(BeNil())
+			Expect(*resolved.Direct).To(BeTrue())
+			Expect(resolved.Origins["direct"]).To(Equal(watchdog.OriginDefault))
+		})
+
+		It("runs the watchdog through a shell to source the application's .profile", func() {
+			Expect(ioutil.WriteFile(filepath.Join(appDir, ".profile"), []byte("export exec_timeout=10s\n"), 0644)).To(Succeed())
+
+			resolved, err := watchdog.ResolveDirect(watchdog.Config{Origins: watchdog.Origins{}}, appDir)
+			Expect(err).To(BeNil())
+			Expect(*resolved.Direct).To(BeFalse())
+			Expect(resolved.Origins["direct"]).To(Equal(watchdog.OriginProfile))
+		})
+
+		It("keeps a configured value", func() {
+			Expect(ioutil.WriteFile(filepath.Join(appDir, ".profile"), []byte(""), 0644)).To(Succeed())
+			direct := true
+
+			resolved, err := watchdog.ResolveDirect(watchdog.Config{Direct: &direct}, appDir)
+			Expect(err).To(BeNil())
+			Expect(*resolved.Direct).To(BeTrue())
+		})
+	})
+
+	Describe("ResolveDefaultProcess", func() {
+		var (
+			appDir string
+			conf   watchdog.Config
+		)
+
+		BeforeEach(func() {
+			var err error
+			appDir, err = ioutil.TempDir(tmpDir, "app")
+			Expect(err).To(BeNil())
+
+			conf = watchdog.Config{
+				ProcessType:    "web",
+				DefaultProcess: flag(true),
+				Wrap:           []string{"web", "worker"},
+				Origins:        watchdog.Origins{},
+			}
+		})
+
+		It("replaces the web process defined by the application", func() {
+			Expect(ioutil.WriteFile(filepath.Join(appDir, "Procfile"), []byte("web: ruby app.rb -p 8082\nworker: ruby worker.rb\n"), 0644)).To(Succeed())
+
+			resolved, err := watchdog.ResolveDefaultProcess(conf, appDir)
+			Expect(err).To(BeNil())
+			Expect(resolved.WebUpstream).To(Equal("ruby app.rb -p 8082"))
+			Expect(resolved.ProcessType).To(Equal("web-upstream"))
+			Expect(resolved.Wrap).To(Equal([]string{"web", "worker"}))
+			Expect(resolved.Origins["process_type"]).To(Equal(watchdog.OriginDefaultProcess))
+		})
+
+		It("uses the web command of project.toml", func() {
+			Expect(ioutil.WriteFile(filepath.Join(appDir, "project.toml"), []byte(`
+[[io.buildpacks.processes]]
+type = "web"
+command = "node server.js"
+`), 0644)).To(Succeed())
+
+			resolved, err := watchdog.ResolveDefaultProcess(conf, appDir)
+			Expect(err).To(BeNil())
+			Expect(resolved.WebUpstream).To(Equal("node server.js"))
+		})
+
+		It("doesn't replace a web process contributed by another buildpack", func() {
+			resolved, err := watchdog.ResolveDefaultProcess(conf, appDir)
+			Expect(err).To(BeNil())
+			Expect(resolved.WebUpstream).To(BeEmpty())
+			Expect(resolved.ProcessType).To(Equal("web"))
+		})
+
+		It("doesn't replace web without default_process", func() {
+			Expect(ioutil.WriteFile(filepath.Join(appDir, "Procfile"), []byte("web: ruby app.rb\n"), 0644)).To(Succeed())
+			conf.DefaultProcess = flag(false)
+
+			resolved, err := watchdog.ResolveDefaultProcess(conf, appDir)
+			Expect(err).To(BeNil())
+			Expect(resolved.WebUpstream).To(BeEmpty())
+			Expect(resolved.ProcessType).To(Equal("web"))
+		})
+	})
+
+	Describe("ResolveProcessType", func() {
+		It("doesn't check the process type in static mode", func() {
+			conf := watchdog.Config{ProcessType: "web", Mode: "static", StaticPath: "public"}
+
+			_, err := watchdog.ResolveProcessType(conf, []string{"worker"})
+			Expect(err).To(BeNil())
+		})
+
+		It("leaves the config unchanged when the process types are unknown", func() {
+			conf := watchdog.DefaultConfig()
+			resolved, err := watchdog.ResolveProcessType(conf, nil)
+			Expect(err).To(BeNil())
+			Expect(resolved).To(Equal(conf))
+		})
+
+		It("picks the only defined process type when none is configured", func() {
+			conf, err := watchdog.LoadConfig(nil, "", nil)
+			Expect(err).To(BeNil())
+			conf.Functions = []watchdog.Function{{Name: "resize", ProcessType: "web"}}
+
+			resolved, err := watchdog.ResolveProcessType(conf, []string{"worker"})
+			Expect(err).To(BeNil())
+			Expect(resolved.ProcessType).To(Equal("worker"))
+			Expect(resolved.Functions[0].ProcessType).To(Equal("worker"))
+			Expect(resolved.Origins["process_type"]).To(Equal("only defined process type"))
+		})
+
+		It("fails when the configured process type isn't defined", func() {
+			conf := watchdog.Config{ProcessType: "web", Origins: watchdog.Origins{"process_type": "watchdog.toml"}}
+
+			_, err := watchdog.ResolveProcessType(conf, []string{"worker"})
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(Equal("process type 'web' (watchdog.toml) not found, available process types: [worker]"))
+		})
+
+		It("wraps every process type with wrap_all", func() {
+			conf := watchdog.Config{
+				ProcessType: "web",
+				WrapAll:     flag(true),
+				Origins:     watchdog.Origins{"process_type": "watchdog.toml", "wrap_all": "watchdog.toml"},
+			}
+
+			resolved, err := watchdog.ResolveProcessType(conf, []string{"web", "worker"})
+			Expect(err).To(BeNil())
+			Expect(resolved.Wrap).To(Equal([]string{"web", "worker"}))
+			Expect(resolved.Origins["wrap"]).To(Equal("watchdog.toml"))
+		})
+
+		It("fails to wrap every process type when they are unknown", func() {
+			_, err := watchdog.ResolveProcessType(watchdog.Config{ProcessType: "web", WrapAll: flag(true)}, nil)
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(Equal("wrap_all requires the application to define its process types"))
+		})
+
+		It("fails when a wrapped process type isn't defined", func() {
+			conf := watchdog.Config{
+				ProcessType: "web",
+				Wrap:        []string{"web", "worker"},
+				Origins:     watchdog.Origins{"process_type": "watchdog.toml", "wrap": "watchdog.toml"},
+			}
+
+			_, err := watchdog.ResolveProcessType(conf, []string{"web"})
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(Equal("process type 'worker' (watchdog.toml) not found, available process types: [web]"))
+		})
+
+		It("fails when a function's process type isn't defined", func() {
+			conf := watchdog.Config{
+				ProcessType: "web",
+				Functions:   []watchdog.Function{{Name: "resize", ProcessType: "resizer"}},
+				Origins:     watchdog.Origins{"process_type": "watchdog.toml", "functions": "project.toml"},
+			}
+
+			_, err := watchdog.ResolveProcessType(conf, []string{"web", "worker"})
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(Equal("process type 'resizer' (project.toml) not found, available process types: [web, worker]"))
+		})
+	})
+
+	Describe("Explain", func() {
+		It("annotates each value with its origin", func() {
+			appDir, err := ioutil.TempDir(tmpDir, "app")
+			Expect(err).To(BeNil())
+
+			Expect(ioutil.WriteFile(filepath.Join(appDir, "project.toml"), []byte(`
+[metadata.openfaas.watchdog.env]
+exec_timeout = "10s"
+`), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(appDir, "watchdog.toml"), []byte(`
+[watchdog]
+process_type = "worker"
+
+[[watchdog.functions]]
+name = "resize"
+`), 0644)).To(Succeed())
+
+			sources, err := watchdog.ConfigPaths(appDir, "")
+			Expect(err).To(BeNil())
+
+			conf, err := watchdog.LoadConfig(sources, "", map[string]string{"BP_WATCHDOG_VERSION": "0.8.0"})
+			Expect(err).To(BeNil())
+
+			Expect(watchdog.Explain(conf)).To(Equal(`version = "0.8.0" (platform env)
+process_type = "worker" (watchdog.toml)
+env.exec_timeout = "10s" (project.toml)
+functions[0].name = "resize" (watchdog.toml)
+functions[0].process_type = "worker" (watchdog.toml)`))
+		})
+	})
+
+	Describe("Schema", func() {
+		It("describes every config key", func() {
+			b, err := watchdog.Schema()
+			Expect(err).To(BeNil())
+
+			var schema struct {
+				Definitions map[string]struct {
+					Properties map[string]interface{} `json:"properties"`
+				} `json:"definitions"`
+			}
+			Expect(json.Unmarshal(b, &schema)).To(Succeed())
+			Expect(schema.Definitions["Config"].Properties).To(HaveKey("version"))
+			Expect(schema.Definitions["Config"].Properties).To(HaveKey("process_type"))
+			Expect(schema.Definitions["Config"].Properties).To(HaveKey("profiles"))
+			Expect(schema.Definitions["Config"].Properties).ToNot(HaveKey("Origins"))
+			Expect(schema.Definitions["Function"].Properties).To(HaveKey("port"))
+		})
 	})
 
 	Describe("Contributor", func() {
 		var (
 			lyrs layers.Layers
+			api  = launch.API{Major: 0, Minor: 6}
 		)
 
 		BeforeEach(func() {
@@ -97,6 +1385,7 @@ key1 = "value1"
 				layerCreator := watchdog.NewContributor(logger.Logger{}, httpClient)
 				_, err := layerCreator.Contribute(
 					lyrs,
+					launch.NewMetadata(api),
 					watchdog.Config{Version: "0.0.1"},
 				)
 				Expect(err).To(BeNil())
@@ -113,6 +1402,7 @@ key1 = "value1"
 
 					l, err := layerCreator.Contribute(
 						lyrs,
+						launch.NewMetadata(api),
 						watchdog.Config{Version: "0.0.1"},
 					)
 					Expect(err).To(BeNil())
@@ -133,6 +1423,7 @@ key1 = "value1"
 
 					l, err := layerCreator.Contribute(
 						lyrs,
+						launch.NewMetadata(api),
 						watchdog.Config{Version: "0.0.2"},
 					)
 					Expect(err).To(BeNil())
@@ -152,11 +1443,13 @@ key1 = "value1"
 				}, nil)
 				layerCreator := watchdog.NewContributor(logger.Logger{}, httpClient)
 
-				watchdogLayer, err := layerCreator.Contribute(lyrs, watchdog.Config{
+				launchMetadata := launch.NewMetadata(api)
+				watchdogLayer, err := layerCreator.Contribute(lyrs, launchMetadata, watchdog.Config{
 					Version:     "0.0.1",
 					ProcessType: "blah",
 				})
 				Expect(err).To(BeNil())
+				Expect(launchMetadata.Write(lyrs)).To(Succeed())
 
 				md := &layers.Metadata{}
 				_, err = toml.DecodeFile(filepath.Join(lyrs.Root, "launch.toml"), md)
@@ -171,6 +1464,556 @@ key1 = "value1"
 			})
 		})
 
+		Context("when other processes have been contributed", func() {
+			It("fails when a process type is contributed twice", func() {
+				httpClient := watchdog.NewHttpClientMock(mc).GetMock.Return(&http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte("version 0.0.1"))),
+				}, nil)
+				layerCreator := watchdog.NewContributor(logger.Logger{}, httpClient)
+
+				launchMetadata := launch.NewMetadata(api)
+				Expect(launchMetadata.AddProcess("shim", layers.Process{Type: "faas", Command: "node index.js"})).To(Succeed())
+
+				_, err := layerCreator.Contribute(lyrs, launchMetadata, watchdog.Config{
+					Version:     "0.0.1",
+					ProcessType: "web",
+				})
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(Equal("process type 'faas' contributed by watchdog is already contributed by shim"))
+			})
+		})
+
+		Context("when slices are set", func() {
+			It("should write them into the launch metadata", func() {
+				httpClient := watchdog.NewHttpClientMock(mc).GetMock.Return(&http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte("version 0.0.1"))),
+				}, nil)
+				layerCreator := watchdog.NewContributor(logger.Logger{}, httpClient)
+
+				launchMetadata := launch.NewMetadata(api)
+				_, err := layerCreator.Contribute(lyrs, launchMetadata, watchdog.Config{
+					Version:     "0.0.1",
+					ProcessType: "web",
+					Slices:      []watchdog.Slice{{Paths: []string{"vendor/**"}}, {Paths: []string{"function/**"}}},
+				})
+				Expect(err).To(BeNil())
+				Expect(launchMetadata.Write(lyrs)).To(Succeed())
+
+				md := &layers.Metadata{}
+				_, err = toml.DecodeFile(filepath.Join(lyrs.Root, "launch.toml"), md)
+				Expect(err).To(BeNil())
+				Expect(md.Slices).To(Equal(layers.Slices{
+					{Paths: []string{"vendor/**"}},
+					{Paths: []string{"function/**"}},
+				}))
+			})
+		})
+
+		Context("when env vars have launch-time references", func() {
+			contribute := func(api launch.API, conf watchdog.Config) (*layers.Layer, error) {
+				httpClient := watchdog.NewHttpClientMock(mc).GetMock.Return(&http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte("version 0.0.1"))),
+				}, nil)
+				layerCreator := watchdog.NewContributor(logger.Logger{}, httpClient)
+
+				return layerCreator.Contribute(lyrs, launch.NewMetadata(api), conf)
+			}
+
+			It("should list them for expansion when the container starts", func() {
+				watchdogLayer, err := contribute(api, watchdog.Config{
+					Version:     "0.0.1",
+					ProcessType: "web",
+					Env: map[string]string{
+						"upstream_url":  "http://127.0.0.1:${PORT}",
+						"exec_timeout":  "${TIMEOUT:-10s}",
+						"write_timeout": "10s",
+					},
+				})
+				Expect(err).To(BeNil())
+
+				b, err := ioutil.ReadFile(filepath.Join(watchdogLayer.Root, "env.launch", "OPENFAAS_EXPAND_ENV.default"))
+				Expect(err).To(BeNil())
+				Expect(string(b)).To(Equal("exec_timeout,upstream_url"))
+			})
+
+			It("should require a buildpack API running exec.d executables", func() {
+				_, err := contribute(launch.API{Major: 0, Minor: 4}, watchdog.Config{
+					Version:     "0.0.1",
+					ProcessType: "web",
+					Env:         map[string]string{"upstream_url": "http://127.0.0.1:${PORT}"},
+				})
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(Equal("launch-time references in env require buildpack API 0.5 or later, the buildpack declares 0.4"))
+			})
+
+			It("should leave them to the shell in function launchers", func() {
+				watchdogLayer, err := contribute(api, watchdog.Config{
+					Version:     "0.0.1",
+					ProcessType: "web",
+					Functions: []watchdog.Function{{
+						Name:        "resize",
+						ProcessType: "web",
+						Env: map[string]string{
+							"upstream_url": "http://127.0.0.1:${PORT}/'a'",
+							"exec_timeout": `${TIMEOUT:-$1"0s}`,
+						},
+					}},
+				})
+				Expect(err).To(BeNil())
+
+				launcher := filepath.Join(watchdogLayer.Root, "functions", "faas-resize")
+				b, err := ioutil.ReadFile(launcher)
+				Expect(err).To(BeNil())
+				Expect(string(b)).To(ContainSubstring(
+					`export upstream_url='http://127.0.0.1:'"${PORT:?variable PORT is not set}"'/'\''a'\'''` + "\n",
+				))
+
+				script := strings.Replace(string(b), "exec ", "echo ", 1) + "echo \"$upstream_url $exec_timeout\"\n"
+				Expect(ioutil.WriteFile(launcher, []byte(script), 0755)).To(Succeed())
+
+				command := exec.Command(launcher)
+				command.Env = []string{"PATH=" + os.Getenv("PATH"), "PORT=3000"}
+				out, err := command.CombinedOutput()
+				Expect(err).To(BeNil(), string(out))
+				Expect(string(out)).To(HaveSuffix("http://127.0.0.1:3000/'a' $1\"0s\n"))
+
+				command = exec.Command(launcher)
+				command.Env = []string{"PATH=" + os.Getenv("PATH")}
+				out, err = command.CombinedOutput()
+				Expect(err).ToNot(BeNil())
+				Expect(string(out)).To(ContainSubstring("variable PORT is not set"))
+			})
+		})
+
+		Context("when the watchdog is installed", func() {
+			It("should describe it in the bill of materials and the layer's SBOM", func() {
+				httpClient := watchdog.NewHttpClientMock(mc).GetMock.Return(&http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte("version 0.0.1"))),
+				}, nil)
+				layerCreator := watchdog.NewContributor(logger.Logger{}, httpClient)
+
+				launchMetadata := launch.NewMetadata(api)
+				watchdogLayer, err := layerCreator.Contribute(lyrs, launchMetadata, watchdog.Config{
+					Version:     "0.0.1",
+					ProcessType: "web",
+				})
+				Expect(err).To(BeNil())
+				Expect(launchMetadata.Write(lyrs)).To(Succeed())
+
+				md := &struct {
+					BOM []struct {
+						Name     string            `toml:"name"`
+						Metadata map[string]string `toml:"metadata"`
+					} `toml:"bom"`
+				}{}
+				_, err = toml.DecodeFile(filepath.Join(lyrs.Root, "launch.toml"), md)
+				Expect(err).To(BeNil())
+				Expect(md.BOM).To(HaveLen(1))
+				Expect(md.BOM[0].Name).To(Equal("of-watchdog"))
+				Expect(md.BOM[0].Metadata).To(Equal(map[string]string{
+					"version": "0.0.1",
+					"uri":     "https://github.com/openfaas-incubator/of-watchdog/releases/download/0.0.1/of-watchdog",
+					// sha256 of "version 0.0.1"
+					"sha256":  "2ca738cfe82de057fe8e6541e0b501005490a34a798954e294ccb664a9bb0eef",
+					"license": "MIT",
+				}))
+
+				Expect(filepath.Join(watchdogLayer.Root, "sbom.cdx.json")).To(BeAnExistingFile())
+			})
+		})
+
+		Context("when the watchdog process options are set", func() {
+			contribute := func(api launch.API, conf watchdog.Config) (*layers.Layer, []map[string]interface{}) {
+				httpClient := watchdog.NewHttpClientMock(mc).GetMock.Return(&http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte("version 0.0.1"))),
+				}, nil)
+				layerCreator := watchdog.NewContributor(logger.Logger{}, httpClient)
+
+				launchMetadata := launch.NewMetadata(api)
+				watchdogLayer, err := layerCreator.Contribute(lyrs, launchMetadata, conf)
+				Expect(err).To(BeNil())
+				Expect(launchMetadata.Write(lyrs)).To(Succeed())
+
+				md := &struct {
+					Processes []map[string]interface{} `toml:"processes"`
+				}{}
+				_, err = toml.DecodeFile(filepath.Join(lyrs.Root, "launch.toml"), md)
+				Expect(err).To(BeNil())
+				return watchdogLayer, md.Processes
+			}
+
+			It("should exec the watchdog directly by default", func() {
+				_, processes := contribute(api, watchdog.Config{Version: "0.0.1", ProcessType: "web"})
+				Expect(processes[0]["direct"]).To(BeTrue())
+			})
+
+			It("should pass the args and direct to every watchdog process", func() {
+				direct := false
+				_, processes := contribute(api, watchdog.Config{
+					Version:     "0.0.1",
+					ProcessType: "web",
+					Direct:      &direct,
+					Args:        []string{"--flag"},
+					Wrap:        []string{"worker"},
+				})
+				Expect(processes).To(HaveLen(2))
+				for _, process := range processes {
+					Expect(process["direct"]).To(BeFalse())
+					Expect(process["args"]).To(Equal([]interface{}{"--flag"}))
+				}
+			})
+
+			It("should declare working_dir for newer buildpack APIs", func() {
+				_, processes := contribute(launch.API{Major: 0, Minor: 8}, watchdog.Config{
+					Version:     "0.0.1",
+					ProcessType: "web",
+					WorkingDir:  "function",
+				})
+				Expect(processes[0]["working-dir"]).To(Equal("function"))
+			})
+
+			It("should change to working_dir in a launcher for older buildpack APIs", func() {
+				watchdogLayer, processes := contribute(api, watchdog.Config{
+					Version:     "0.0.1",
+					ProcessType: "web",
+					WorkingDir:  "function",
+				})
+				Expect(processes[0]).ToNot(HaveKey("working-dir"))
+				Expect(processes[0]["command"]).To(Equal(filepath.Join(watchdogLayer.Root, "functions", "faas")))
+
+				b, err := ioutil.ReadFile(filepath.Join(watchdogLayer.Root, "functions", "faas"))
+				Expect(err).To(BeNil())
+				Expect(string(b)).To(Equal(fmt.Sprintf(
+					"#!/usr/bin/env bash\ncd 'function' || exit 1\nexec '%s' \"$@\"\n",
+					filepath.Join(watchdogLayer.Root, "watchdog"),
+				)))
+			})
+		})
+
+		Context("when labels are set", func() {
+			contribute := func(api launch.API, conf watchdog.Config) (*launch.Metadata, error) {
+				httpClient := watchdog.NewHttpClientMock(mc).GetMock.Return(&http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte("version 0.0.1"))),
+				}, nil)
+				layerCreator := watchdog.NewContributor(logger.Logger{}, httpClient)
+
+				launchMetadata := launch.NewMetadata(api)
+				_, err := layerCreator.Contribute(lyrs, launchMetadata, conf)
+				return launchMetadata, err
+			}
+
+			It("should write them, and the standard labels, into the launch metadata", func() {
+				launchMetadata, err := contribute(api, watchdog.Config{
+					Version:     "0.0.1",
+					ProcessType: "web",
+					Mode:        "http",
+					Labels:      map[string]string{"com.openfaas.scale.min": "2"},
+					Annotations: map[string]string{"topic": "uploads"},
+				})
+				Expect(err).To(BeNil())
+				Expect(launchMetadata.Write(lyrs)).To(Succeed())
+
+				md := &struct {
+					Labels []struct {
+						Key   string `toml:"key"`
+						Value string `toml:"value"`
+					} `toml:"labels"`
+				}{}
+				_, err = toml.DecodeFile(filepath.Join(lyrs.Root, "launch.toml"), md)
+				Expect(err).To(BeNil())
+
+				labels := map[string]string{}
+				for _, label := range md.Labels {
+					labels[label.Key] = label.Value
+				}
+				Expect(labels).To(Equal(map[string]string{
+					"com.openfaas.watchdog.version":  "0.0.1",
+					"com.openfaas.watchdog.mode":     "http",
+					"com.openfaas.scale.min":         "2",
+					"com.openfaas.annotations.topic": "uploads",
+				}))
+			})
+
+			It("should skip the standard labels for older buildpack APIs", func() {
+				_, err := contribute(launch.API{Major: 0, Minor: 4}, watchdog.Config{Version: "0.0.1", ProcessType: "web"})
+				Expect(err).To(BeNil())
+			})
+
+			It("should fail for older buildpack APIs", func() {
+				_, err := contribute(launch.API{Major: 0, Minor: 4}, watchdog.Config{
+					Version:     "0.0.1",
+					ProcessType: "web",
+					Labels:      map[string]string{"com.openfaas.scale.min": "2"},
+				})
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(Equal("image labels require buildpack API 0.5 or later, the buildpack declares 0.4"))
+			})
+		})
+
+		Context("when 'mode' is static", func() {
+			It("should serve static_path without an upstream process", func() {
+				httpClient := watchdog.NewHttpClientMock(mc).GetMock.Return(&http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte("version 0.0.1"))),
+				}, nil)
+				layerCreator := watchdog.NewContributor(logger.Logger{}, httpClient)
+
+				watchdogLayer, err := layerCreator.Contribute(lyrs, launch.NewMetadata(api), watchdog.Config{
+					Version:     "0.0.1",
+					ProcessType: "web",
+					Mode:        "static",
+					StaticPath:  "/workspace/public",
+				})
+				Expect(err).To(BeNil())
+
+				b, err := ioutil.ReadFile(filepath.Join(watchdogLayer.Root, "env.launch", "static_path.default"))
+				Expect(err).To(BeNil())
+				Expect(string(b)).To(Equal("/workspace/public"))
+				Expect(filepath.Join(watchdogLayer.Root, "env.launch", "function_process.default")).ToNot(BeAnExistingFile())
+			})
+		})
+
+		Context("when process types are wrapped", func() {
+			It("should create a 'faas-<type>' process type for each, with its own function_process", func() {
+				httpClient := watchdog.NewHttpClientMock(mc).GetMock.Return(&http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte("version 0.0.1"))),
+				}, nil)
+				layerCreator := watchdog.NewContributor(logger.Logger{}, httpClient)
+
+				launchMetadata := launch.NewMetadata(api)
+				watchdogLayer, err := layerCreator.Contribute(lyrs, launchMetadata, watchdog.Config{
+					Version:     "0.0.1",
+					ProcessType: "web",
+					Wrap:        []string{"web", "worker"},
+				})
+				Expect(err).To(BeNil())
+				Expect(launchMetadata.Write(lyrs)).To(Succeed())
+
+				md := &layers.Metadata{}
+				_, err = toml.DecodeFile(filepath.Join(lyrs.Root, "launch.toml"), md)
+				Expect(err).To(BeNil())
+
+				Expect(md.Processes).To(HaveLen(3))
+				Expect(md.Processes[0].Type).To(Equal("faas"))
+				Expect(md.Processes[1].Type).To(Equal("faas-web"))
+				Expect(md.Processes[2].Type).To(Equal("faas-worker"))
+
+				b, err := ioutil.ReadFile(md.Processes[2].Command)
+				Expect(err).To(BeNil())
+				Expect(string(b)).To(Equal(`#!/usr/bin/env bash
+export function_process='/cnb/lifecycle/launcher worker'
+exec '` + filepath.Join(watchdogLayer.Root, "watchdog") + `' "$@"
+`))
+			})
+		})
+
+		Context("when 'default_process' is set", func() {
+			It("makes the 'faas' process the default", func() {
+				httpClient := watchdog.NewHttpClientMock(mc).GetMock.Return(&http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte("version 0.0.1"))),
+				}, nil)
+				layerCreator := watchdog.NewContributor(logger.Logger{}, httpClient)
+
+				launchMetadata := launch.NewMetadata(api)
+				_, err := layerCreator.Contribute(lyrs, launchMetadata, watchdog.Config{
+					Version:        "0.0.1",
+					ProcessType:    "web",
+					DefaultProcess: flag(true),
+				})
+				Expect(err).To(BeNil())
+				Expect(launchMetadata.Write(lyrs)).To(Succeed())
+
+				var md struct {
+					Processes []struct {
+						Type    string `toml:"type"`
+						Default bool   `toml:"default"`
+					} `toml:"processes"`
+				}
+				_, err = toml.DecodeFile(filepath.Join(lyrs.Root, "launch.toml"), &md)
+				Expect(err).To(BeNil())
+				Expect(md.Processes).To(HaveLen(1))
+				Expect(md.Processes[0].Type).To(Equal("faas"))
+				Expect(md.Processes[0].Default).To(BeTrue())
+			})
+
+			It("replaces the application's web process with the watchdog", func() {
+				httpClient := watchdog.NewHttpClientMock(mc).GetMock.Return(&http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte("version 0.0.1"))),
+				}, nil)
+				layerCreator := watchdog.NewContributor(logger.Logger{}, httpClient)
+
+				launchMetadata := launch.NewMetadata(api)
+				watchdogLayer, err := layerCreator.Contribute(lyrs, launchMetadata, watchdog.Config{
+					Version:        "0.0.1",
+					ProcessType:    "web-upstream",
+					DefaultProcess: flag(true),
+					WebUpstream:    "ruby app.rb",
+				})
+				Expect(err).To(BeNil())
+				Expect(launchMetadata.Write(lyrs)).To(Succeed())
+
+				var md struct {
+					Processes []struct {
+						Type    string `toml:"type"`
+						Command string `toml:"command"`
+						Direct  bool   `toml:"direct"`
+						Default bool   `toml:"default"`
+					} `toml:"processes"`
+				}
+				_, err = toml.DecodeFile(filepath.Join(lyrs.Root, "launch.toml"), &md)
+				Expect(err).To(BeNil())
+				Expect(md.Processes).To(HaveLen(3))
+				Expect(md.Processes[0].Type).To(Equal("faas"))
+				Expect(md.Processes[0].Default).To(BeFalse())
+				Expect(md.Processes[1].Type).To(Equal("web"))
+				Expect(md.Processes[1].Command).To(Equal(filepath.Join(watchdogLayer.Root, "watchdog")))
+				Expect(md.Processes[1].Default).To(BeTrue())
+				Expect(md.Processes[2].Type).To(Equal("web-upstream"))
+				Expect(md.Processes[2].Command).To(Equal("ruby app.rb"))
+				Expect(md.Processes[2].Direct).To(BeFalse())
+
+				Expect(filepath.Join(watchdogLayer.Root, "env.launch", "function_process.default")).To(BeARegularFile())
+				b, err := ioutil.ReadFile(filepath.Join(watchdogLayer.Root, "env.launch", "function_process.default"))
+				Expect(err).To(BeNil())
+				Expect(string(b)).To(Equal("/cnb/lifecycle/launcher web-upstream"))
+			})
+
+			It("keeps the name of a wrapped web process, running the replaced one", func() {
+				httpClient := watchdog.NewHttpClientMock(mc).GetMock.Return(&http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte("version 0.0.1"))),
+				}, nil)
+				layerCreator := watchdog.NewContributor(logger.Logger{}, httpClient)
+
+				launchMetadata := launch.NewMetadata(api)
+				watchdogLayer, err := layerCreator.Contribute(lyrs, launchMetadata, watchdog.Config{
+					Version:        "0.0.1",
+					ProcessType:    "web-upstream",
+					DefaultProcess: flag(true),
+					Wrap:           []string{"web"},
+					WebUpstream:    "ruby app.rb",
+				})
+				Expect(err).To(BeNil())
+				Expect(launchMetadata.ProcessTypes()).To(ContainElement("faas-web"))
+				Expect(launchMetadata.ProcessTypes()).ToNot(ContainElement("faas-web-upstream"))
+
+				b, err := ioutil.ReadFile(filepath.Join(watchdogLayer.Root, "functions", "faas-web"))
+				Expect(err).To(BeNil())
+				Expect(string(b)).To(ContainSubstring("export function_process='/cnb/lifecycle/launcher web-upstream'"))
+			})
+		})
+
+		Context("when functions are declared", func() {
+			It("should create a 'faas-<name>' process type for each function", func() {
+				httpClient := watchdog.NewHttpClientMock(mc).GetMock.Return(&http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte("version 0.0.1"))),
+				}, nil)
+				layerCreator := watchdog.NewContributor(logger.Logger{}, httpClient)
+
+				launchMetadata := launch.NewMetadata(api)
+				watchdogLayer, err := layerCreator.Contribute(lyrs, launchMetadata, watchdog.Config{
+					Version:     "0.0.1",
+					ProcessType: "web",
+					Functions: []watchdog.Function{
+						{Name: "resize", ProcessType: "resizer", Port: 8081, Env: map[string]string{"mode": "http"}},
+						{Name: "thumbnail", ProcessType: "web"},
+					},
+				})
+				Expect(err).To(BeNil())
+				Expect(launchMetadata.Write(lyrs)).To(Succeed())
+
+				md := &layers.Metadata{}
+				_, err = toml.DecodeFile(filepath.Join(lyrs.Root, "launch.toml"), md)
+				Expect(err).To(BeNil())
+
+				Expect(md.Processes).To(HaveLen(2))
+				Expect(md.Processes[0].Type).To(Equal("faas-resize"))
+				Expect(md.Processes[1].Type).To(Equal("faas-thumbnail"))
+
+				b, err := ioutil.ReadFile(md.Processes[0].Command)
+				Expect(err).To(BeNil())
+				Expect(string(b)).To(Equal(`#!/usr/bin/env bash
+export function_process='/cnb/lifecycle/launcher resizer'
+export mode='http'
+export port='8081'
+exec '` + filepath.Join(watchdogLayer.Root, "watchdog") + `' "$@"
+`))
+
+				b, err = ioutil.ReadFile(md.Processes[1].Command)
+				Expect(err).To(BeNil())
+				Expect(string(b)).To(ContainSubstring("export function_process='/cnb/lifecycle/launcher web'\n"))
+				Expect(string(b)).ToNot(ContainSubstring("port="))
+			})
+		})
+
+		Context("when env and a profile are set", func() {
+			It("should write the env vars and record the profile in the layer metadata", func() {
+				httpClient := watchdog.NewHttpClientMock(mc).GetMock.Return(&http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(bytes.NewReader([]byte("version 0.0.1"))),
+				}, nil)
+				layerCreator := watchdog.NewContributor(logger.Logger{}, httpClient)
+
+				conf := watchdog.Config{
+					Version:     "0.0.1",
+					ProcessType: "web",
+					Env:         map[string]string{"exec_timeout": "60s"},
+					Profile:     "prod",
+				}
+				watchdogLayer, err := layerCreator.Contribute(lyrs, launch.NewMetadata(api), conf)
+				Expect(err).To(BeNil())
+
+				b, err := ioutil.ReadFile(filepath.Join(watchdogLayer.Root, "env.launch", "exec_timeout.default"))
+				Expect(err).To(BeNil())
+				Expect(string(b)).To(Equal("60s"))
+
+				var md struct {
+					Metadata struct {
+						Profile string
+						Config  watchdog.Config
+					} `toml:"metadata"`
+				}
+				_, err = toml.DecodeFile(watchdogLayer.Metadata, &md)
+				Expect(err).To(BeNil())
+				Expect(md.Metadata.Profile).To(Equal("prod"))
+				Expect(md.Metadata.Config.Env).To(Equal(conf.Env))
+			})
+		})
+
+		Context("when binary_path is set", func() {
+			It("copies the binary instead of downloading", func() {
+				httpClient := watchdog.NewHttpClientMock(mc).GetMock.Set(func(url string) (_ *http.Response, _ error) {
+					Fail("tried to download: " + url)
+					return nil, nil
+				})
+				layerCreator := watchdog.NewContributor(logger.Logger{}, httpClient)
+
+				binaryPath := filepath.Join(tmpDir, "of-watchdog")
+				Expect(ioutil.WriteFile(binaryPath, []byte("local watchdog"), 0755)).To(Succeed())
+
+				l, err := layerCreator.Contribute(lyrs, launch.NewMetadata(api), watchdog.Config{
+					Version:     "0.0.1",
+					BinaryPath:  binaryPath,
+					ProcessType: "web",
+				})
+				Expect(err).To(BeNil())
+
+				b, err := ioutil.ReadFile(filepath.Join(l.Root, "watchdog"))
+				Expect(err).To(BeNil())
+				Expect(string(b)).To(Equal("local watchdog"))
+			})
+		})
+
 		Context("when version is not found", func() {
 			It("should fail", func() {
 				httpClient := watchdog.NewHttpClientMock(mc).GetMock.Return(&http.Response{
@@ -179,7 +2022,7 @@ key1 = "value1"
 				}, nil)
 				layerCreator := watchdog.NewContributor(logger.Logger{}, httpClient)
 
-				_, err := layerCreator.Contribute(lyrs, watchdog.Config{
+				_, err := layerCreator.Contribute(lyrs, launch.NewMetadata(api), watchdog.Config{
 					Version:     "0.0.1",
 					ProcessType: "blah",
 				})